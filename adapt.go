@@ -7,10 +7,12 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"flag"
 	"fmt"
 	"os"
 	"os/exec"
+	pathpkg "path"
 	"path/filepath"
 	"runtime"
 	"sort"
@@ -20,9 +22,11 @@ import (
 	rpast "github.com/rogpeppe/godef/go/ast"
 	rpprinter "github.com/rogpeppe/godef/go/printer"
 	rptypes "github.com/rogpeppe/godef/go/types"
+	goparser "go/parser"
 	gotoken "go/token"
 	gotypes "go/types"
 	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/types/typeutil"
 )
 
 var forcePackages triBool
@@ -111,17 +115,80 @@ func adaptGodef(cfg *packages.Config, filename string, src []byte, searchpos int
 		usePackages = false
 	}
 	if usePackages {
-		fset, obj, err := godefPackages(cfg, filename, src, searchpos)
+		fset, pkg, obj, err := godefPackages(cfg, filename, src, searchpos)
 		if err != nil {
 			return nil, err
 		}
-		return adaptGoObject(fset, obj)
+		return adaptPackagesObject(fset, pkg, obj, filename, src)
 	}
 	obj, typ, err := godef(filename, src, searchpos)
 	if err != nil {
 		return nil, err
 	}
-	return adaptRPObject(obj, typ)
+	result, err := adaptRPObject(obj, typ)
+	if err != nil {
+		return nil, err
+	}
+	// The legacy implementation marks types in the
+	// local package with an empty package path.
+	result.setQualifier(importQualifier(filename, src, ""))
+	return result, nil
+}
+
+// adaptPackagesObject returns the Object for obj, found by
+// the go/packages engine in the given file of pkg.
+func adaptPackagesObject(fset *gotoken.FileSet, pkg *gotypes.Package, obj gotypes.Object, filename string, src []byte) (*Object, error) {
+	result, err := adaptGoObject(fset, obj)
+	if err != nil {
+		return nil, err
+	}
+	if obj.Pkg() != nil {
+		result.Pkg = obj.Pkg().Path()
+	}
+	result.setQualifier(importQualifier(filename, src, pkg.Path()))
+	return result, nil
+}
+
+// qualifier returns the name that qualifies identifiers declared
+// in the package with the given import path and name, or the empty
+// string if they should be left unqualified. The name is empty
+// when it is not known.
+type qualifier func(path, name string) string
+
+// importQualifier returns a qualifier that names packages by the
+// names that the file src, in the package with the given import path,
+// imports them as. Packages that the file does not import are named
+// by their package name.
+func importQualifier(filename string, src []byte, pkgPath string) qualifier {
+	local := make(map[string]string)
+	f, _ := goparser.ParseFile(gotoken.NewFileSet(), filename, src, goparser.ImportsOnly)
+	if f != nil {
+		for _, spec := range f.Imports {
+			path, err := strconv.Unquote(spec.Path.Value)
+			if err != nil || spec.Name == nil || spec.Name.Name == "_" {
+				continue
+			}
+			local[path] = spec.Name.Name
+		}
+	}
+	return func(path, name string) string {
+		if path == pkgPath {
+			return ""
+		}
+		if l, ok := local[path]; ok {
+			if l == "." {
+				return ""
+			}
+			return l
+		}
+		if name == "" {
+			var err error
+			if name, err = rptypes.DefaultImportPathToName(path, filepath.Dir(filename)); err != nil || name == "" {
+				name = pathpkg.Base(path)
+			}
+		}
+		return name
+	}
 }
 
 func adaptRPObject(obj *rpast.Object, typ rptypes.Type) (*Object, error) {
@@ -154,7 +221,9 @@ func adaptRPObject(obj *rpast.Object, typ rptypes.Type) (*Object, error) {
 		}
 	case rpast.Con:
 		result.Kind = ConstKind
-		if decl, ok := obj.Decl.(*rpast.ValueSpec); ok {
+		if v := rptypes.ConstValue(obj, rptypes.DefaultImporter, rptypes.FileSet); v != nil {
+			result.Value = v
+		} else if decl, ok := obj.Decl.(*rpast.ValueSpec); ok {
 			result.Value = decl.Values[0]
 		}
 	case rpast.Lbl:
@@ -164,8 +233,29 @@ func adaptRPObject(obj *rpast.Object, typ rptypes.Type) (*Object, error) {
 		result.Kind = TypeKind
 		result.Type = typ.Underlying(false)
 	}
-	for child := range typ.Iter() {
-		m, err := adaptRPObject(child, rptypes.Type{})
+	var err error
+	typ.Members(context.Background(), -1, func(info rptypes.MemberInfo) bool {
+		var m *Object
+		if m, err = adaptRPObject(info.Obj, rptypes.Type{}); err != nil {
+			return false
+		}
+		result.Members = append(result.Members, m)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(orderedObjects(result.Members))
+	return result, nil
+}
+
+func adaptGoObject(fset *gotoken.FileSet, obj gotypes.Object) (*Object, error) {
+	result, err := adaptGoMember(fset, obj)
+	if err != nil {
+		return nil, err
+	}
+	for _, child := range goMembers(obj) {
+		m, err := adaptGoMember(fset, child)
 		if err != nil {
 			return nil, err
 		}
@@ -175,7 +265,9 @@ func adaptRPObject(obj *rpast.Object, typ rptypes.Type) (*Object, error) {
 	return result, nil
 }
 
-func adaptGoObject(fset *gotoken.FileSet, obj gotypes.Object) (*Object, error) {
+// adaptGoMember is like adaptGoObject except that
+// it does not fill in the members of the object.
+func adaptGoMember(fset *gotoken.FileSet, obj gotypes.Object) (*Object, error) {
 	result := &Object{
 		Name:     obj.Name(),
 		Position: objToPos(fset, obj),
@@ -211,6 +303,78 @@ func adaptGoObject(fset *gotoken.FileSet, obj gotypes.Object) (*Object, error) {
 	return result, nil
 }
 
+// goMembers returns the fields and methods of the type of obj,
+// including promoted ones, or the top level declarations
+// of an imported package.
+func goMembers(obj gotypes.Object) []gotypes.Object {
+	var members []gotypes.Object
+	switch obj := obj.(type) {
+	case *gotypes.PkgName:
+		if obj.Pkg() == nil {
+			return nil
+		}
+		scope := obj.Imported().Scope()
+		for _, name := range scope.Names() {
+			members = append(members, scope.Lookup(name))
+		}
+		return members
+	case *gotypes.TypeName, *gotypes.Var, *gotypes.Const:
+	default:
+		return nil
+	}
+	t := obj.Type()
+	seen := make(map[string]bool)
+	for _, f := range fieldNames(t) {
+		if seen[f.Name()] {
+			continue
+		}
+		seen[f.Name()] = true
+		// Look up the name again so that fields
+		// hidden by shallower fields are omitted.
+		if m, _, _ := gotypes.LookupFieldOrMethod(t, true, f.Pkg(), f.Name()); m == f {
+			members = append(members, m)
+		}
+	}
+	for _, sel := range typeutil.IntuitiveMethodSet(t, nil) {
+		if m := sel.Obj(); !seen[m.Name()] {
+			seen[m.Name()] = true
+			members = append(members, m)
+		}
+	}
+	return members
+}
+
+// fieldNames returns all the fields of t, including
+// the fields of embedded structs, shallowest first.
+func fieldNames(t gotypes.Type) []*gotypes.Var {
+	var fields []*gotypes.Var
+	visited := make(map[gotypes.Type]bool)
+	q := []gotypes.Type{t}
+	for len(q) > 0 {
+		t := q[0]
+		q = q[1:]
+		if p, ok := t.Underlying().(*gotypes.Pointer); ok {
+			t = p.Elem()
+		}
+		if visited[t] {
+			continue
+		}
+		visited[t] = true
+		st, ok := t.Underlying().(*gotypes.Struct)
+		if !ok {
+			continue
+		}
+		for i := 0; i < st.NumFields(); i++ {
+			f := st.Field(i)
+			fields = append(fields, f)
+			if f.Embedded() {
+				q = append(q, f.Type())
+			}
+		}
+	}
+	return fields
+}
+
 func objToPos(fSet *gotoken.FileSet, obj gotypes.Object) Position {
 	p := obj.Pos()
 	f := fSet.File(p)
@@ -230,7 +394,7 @@ func objToPos(fSet *gotoken.FileSet, obj gotypes.Object) Position {
 	if !ok {
 		return pos
 	}
-	in, err := os.Open(f.Name())
+	in, err := os.Open(pos.Filename)
 	if err != nil {
 		return pos
 	}
@@ -257,8 +421,11 @@ func cleanFilename(path string) string {
 	return runtime.GOROOT() + path[len(prefix):]
 }
 
+// pretty formats a type or value from either implementation.
+// Types are qualified by qual if it is non-nil.
 type pretty struct {
-	n interface{}
+	n    interface{}
+	qual qualifier
 }
 
 func (p pretty) Format(f fmt.State, c rune) {
@@ -266,16 +433,21 @@ func (p pretty) Format(f fmt.State, c rune) {
 	case *rpast.BasicLit:
 		rpprinter.Fprint(f, rptypes.FileSet, n)
 	case rptypes.Type:
-		// TODO print path package when appropriate.
-		// Current issues with using p.n.Pkg:
-		//	- we should actually print the local package identifier
-		//	rather than the package path when possible.
-		//	- p.n.Pkg is non-empty even when
-		//	the type is not relative to the package.
-		rpprinter.Fprint(f, rptypes.FileSet, n.Node)
+		node := n.Node
+		if p.qual != nil {
+			node = n.Qualified(func(path string) string {
+				return p.qual(path, "")
+			})
+		}
+		rpprinter.Fprint(f, rptypes.FileSet, node)
 	case gotypes.Type:
 		buf := &bytes.Buffer{}
-		gotypes.WriteType(buf, n, func(p *gotypes.Package) string { return "" })
+		gotypes.WriteType(buf, n, func(pkg *gotypes.Package) string {
+			if p.qual == nil {
+				return ""
+			}
+			return p.qual(pkg.Path(), pkg.Name())
+		})
 		buf.WriteTo(f)
 	default:
 		fmt.Fprint(f, n)
@@ -8,7 +8,20 @@ Godef prints the source location of definitions in Go programs.
 
 Usage:
 
-	godef [-t] [-a] [-A] [-o offset] [-i] [-f file][-acme] [expr]
+	godef [-t] [-a] [-A] [-layout [-arch goarch]] [-hover] [-o offset] [-i] [-f file][-acme] [expr]
+	godef [-t] [-a] [-A] [-hover] -q importpath.Name[.Member]
+	godef [-json] [-deps] -sym pattern
+	godef [-incremental] [-ctags file] [-etags file]
+	godef [-json] -unused
+	godef -http addr
+	godef -html dir
+	godef -9p service
+	godef [-i] -f file -outline
+	godef [-json] [-i] -f file -o offset -highlight
+	godef [-json] [-i] -f file -o offset -refs
+	godef [-json] [-i] -f file -o offset -super
+	godef [-i] -f file -stub importpath.Name -recv receiver
+	godef [-diff] [-json] [-acme] [-i] -f file -o offset -rename newname
 
 File specifies the source file in which to evaluate expr.
 Expr must be an identifier or a Go expression
@@ -24,6 +37,21 @@ members (fields and methods) of the expression,
 and their location, to be printed also; the -A flag
 prints private members too.
 
+The -hover flag prints a Markdown description of the
+expression instead of its location, for editors to show when
+the mouse hovers over it: its declaration as printed by -t, the
+import path of its package, its doc comment, converted to
+Markdown, and, for a type, its exported fields and methods.
+With the -json flag, the location is printed as usual, with
+the description in its "hover" field.
+
+The -layout flag, which implies -t, also prints the size and
+alignment of a struct type, or of the type of a struct variable,
+with the offset, size and alignment of each field and the
+padding between them, and the size the struct would have if its
+fields were sorted by alignment. Sizes are computed for the
+architecture given by the -arch flag, which defaults to $GOARCH.
+
 If the -i flag is specified, the source is read
 from standard input, although file must still
 be specified so that other files in the same source
@@ -32,6 +60,120 @@ package may be found.
 If the -acme flag is given, the offset, file name and contents
 are read from the current acme window.
 
+The -9p flag serves queries as a 9P file system, posted as the
+named service in the plan9port name space, so that acme, plumber
+rules and shell scripts can query a godef that keeps running.
+Writing "file:#offset" to its ctl file, where offset counts runes
+as in acme addresses, sets the query, and reading def, type or
+refs returns the definition's location, its type as printed by
+-t, or its references as printed by -refs. Relative file names
+are taken relative to the directory godef was started in. The
+module's packages are loaded by the first query and kept, until
+one of their files changes, so later queries are quick. For
+example:
+
+	$ godef -9p godef &
+	$ echo $PWD/main.go:#1234 | 9p write godef/ctl
+	$ 9p read godef/def
+
+The -q flag looks up a declaration by its qualified name
+without needing a source file, for example net/http.Client.Do.
+Only the named package is loaded. If the name holds only
+an import path, the package directory is printed.
+
+The -sym flag searches all the package-level declarations
+and methods in the main module for names that fuzzily
+match the pattern, and prints the kind, package and
+location of each, best match first. The -deps flag
+causes the module's dependencies to be searched too.
+Packages that fail to load are searched as far as
+possible, and their errors are printed on standard error.
+
+The -ctags and -etags flags write an index of the package-level
+declarations, methods, fields and interface methods in the main
+module to the named file, in extended ctags format or Emacs etags
+format respectively, for editors that understand tags files.
+Ctags entries hold the kind, line number, enclosing type and
+function signature of each declaration. With the -incremental
+flag, only the files modified since the tags file was last
+written are read again, along with any files in the same
+packages holding methods whose receiver types are declared
+elsewhere.
+
+The -unused flag reports the exported functions, types, fields
+and methods in the main module that are not referred to from
+outside their own package, saying whether each is used inside
+its package, including its external tests, at all. Methods that are needed to implement an
+interface are not reported, and nor are struct fields with tags,
+which are usually used through reflection. Declarations in test
+files and main packages are ignored. Packages that cannot be
+parsed, such as those using generics, are skipped, and the
+skipped packages are listed on standard error.
+
+The -http flag serves the source of the main module, including
+its tests, type checked, as HTML on the given address, such as
+":8080". Each
+identifier links to its declaration and shows its type when the
+mouse hovers over it, and each declaration links to a list of the
+references to it in the module. Declarations outside the module,
+such as those in the standard library, are linked to a copy of
+their source. The pages need nothing from the network.
+
+The -html flag writes the same pages as -http to files in the
+named directory, as a static site that can be browsed from the
+file system or archived. Every declaration in the module has an
+anchor in its file's page, and each package has an index page
+listing its files and package-level declarations.
+
+The -outline flag prints the declarations in file as a JSON
+tree: types hold their fields and methods, and functions,
+constants and variables are at the top level. Each entry
+holds the name, kind, type or signature, and the ranges of
+the whole declaration and of its name.
+
+The -highlight flag prints the range of every reference in
+file to the object identified at offset, classified as a
+declaration, read, write or address. Only the package containing
+file is type checked, so it is fast enough to use for
+highlighting the symbol under the cursor.
+
+The -refs flag is like -highlight, but prints the references
+in every package of the enclosing module, including its tests,
+all of which are type checked. A reference is classified as an address when the
+address of the variable, or of part of it, is taken with &.
+
+The -super flag lists the interface methods implemented by the
+method identified at offset, with the kind, package and location
+of each, the way -sym does. A method is listed when the interface
+declaring it is implemented by the method's receiver type, or a
+pointer to it, and the interfaces searched are those in the main
+module and the packages, including standard ones, that it imports.
+
+The -stub flag adds to file a method stub, with a body that
+panics, for each method of the named interface that the receiver
+given by -recv lacks. The receiver is of the form "T", "*T" or
+"t *T", where T is a type in the package containing file, and the
+stubs follow the declaration of T. Types in the signatures are
+named as file imports their packages, and missing imports are
+added. The file is rewritten and its name printed; with the -i
+flag, the new source is printed instead.
+
+The -rename flag renames the object identified at offset,
+and every reference to it in the enclosing module, and
+prints the names of the files it changed. The renamed code
+is checked before any file is written: if an identifier
+would refer to a different object, if the new name clashes
+with another declaration, or if a type would stop
+implementing an interface, nothing is changed and the
+conflicts are printed instead. The source must be
+the same as the file on disk. Only the renamed identifiers
+change; every other byte of each file is left as it was.
+The changed files are written only once they have all
+been prepared, and each replaces the original in a single step. With the -diff flag,
+a unified diff is printed instead of changing the files;
+with the -json flag, a JSON list of edits is printed, each
+replacing the bytes between two offsets in a file.
+
 Example:
 
 	$ cd $GOROOT
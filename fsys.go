@@ -0,0 +1,531 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/ast"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"9fans.net/go/plan9"
+	"golang.org/x/tools/go/packages"
+)
+
+// godefFsys serves godef queries as a 9P file system, so that
+// acme, plumber rules and shell scripts can query a running godef.
+// The file system holds a single directory with these files:
+//
+//	ctl   write "file:#offset" to set the query; read it back
+//	def   the location of the definition of the identifier
+//	type  the identifier's type, as printed by -t
+//	refs  the references to it in the module, as printed by -refs
+//
+// The offset is in runes, as in acme addresses. There is one query
+// for all clients, so that a query written by one command can be
+// read by another. The result files are computed when they are
+// first opened after the query is set, and kept until it changes;
+// opening a result file for a query that fails returns the error.
+//
+// The packages of the module are loaded once and kept for later
+// queries, until one of the module's files changes, so that only
+// the first query has to wait for them to be type checked.
+type godefFsys struct {
+	ctx context.Context
+
+	// mu guards the query and its results. It is not held
+	// while results are computed, so that other clients can
+	// carry on reading and writing the files meanwhile.
+	mu       sync.Mutex
+	query    string
+	filename string
+	offset   int
+	// vers counts the queries written, and is
+	// the version of the result files' qids.
+	vers    uint32
+	results map[string][]byte
+
+	// loadMu guards loaded, and is held while
+	// packages are loaded.
+	loadMu sync.Mutex
+	loaded *fsysPackages
+}
+
+// fsysPackages holds the packages of a module
+// loaded for an earlier query.
+type fsysPackages struct {
+	root  string
+	tests bool
+	pkgs  []*packages.Package
+	// files holds the state of each file of the
+	// module's packages when they were loaded.
+	files map[string]os.FileInfo
+}
+
+// fsysFiles holds the names of the files in the root
+// directory. The qid path of each is its index plus one;
+// the root directory's is zero.
+var fsysFiles = []string{"ctl", "def", "type", "refs"}
+
+// fsysMsize is the largest message size the server accepts.
+const fsysMsize = 8192 + plan9.IOHDRSIZE
+
+func newGodefFsys(ctx context.Context) *godefFsys {
+	return &godefFsys{
+		ctx:     ctx,
+		results: make(map[string][]byte),
+	}
+}
+
+// serveFsys posts fs as the named service in the plan9port
+// name space, where 9p(1) and 9pfuse(4) can find it,
+// and serves 9P connections to it.
+func serveFsys(fs *godefFsys, service string) error {
+	if err := setNameSpace(); err != nil {
+		return err
+	}
+	addr := filepath.Join(os.Getenv("NAMESPACE"), service)
+	// Remove any socket left by an earlier server.
+	os.Remove(addr)
+	l, err := net.Listen("unix", addr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	log.Printf("serving 9P on %s", addr)
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			if err := fs.serveConn(c); err != nil && err != io.EOF {
+				log.Printf("9P connection: %v", err)
+			}
+		}()
+	}
+}
+
+// fsysFid holds the state of a fid.
+type fsysFid struct {
+	path uint64
+	open bool
+	// data holds the contents of an open result file,
+	// or the entries of an open directory.
+	data []byte
+}
+
+// serveConn serves 9P requests read from c until
+// it is closed, replying to each in turn.
+func (fs *godefFsys) serveConn(c io.ReadWriteCloser) error {
+	defer c.Close()
+	fids := make(map[uint32]*fsysFid)
+	for {
+		tx, err := plan9.ReadFcall(c)
+		if err != nil {
+			return err
+		}
+		rx, err := fs.handle(tx, fids)
+		if err != nil {
+			rx = &plan9.Fcall{Type: plan9.Rerror, Ename: err.Error()}
+		}
+		rx.Tag = tx.Tag
+		if err := plan9.WriteFcall(c, rx); err != nil {
+			return err
+		}
+	}
+}
+
+// handle returns the reply to the request tx.
+func (fs *godefFsys) handle(tx *plan9.Fcall, fids map[uint32]*fsysFid) (*plan9.Fcall, error) {
+	rx := &plan9.Fcall{Type: tx.Type + 1}
+	if tx.Type == plan9.Tversion {
+		rx.Msize = tx.Msize
+		if rx.Msize > fsysMsize {
+			rx.Msize = fsysMsize
+		}
+		rx.Version = "unknown"
+		if strings.HasPrefix(tx.Version, "9P2000") {
+			rx.Version = "9P2000"
+		}
+		// A new session abandons all fids.
+		for fid := range fids {
+			delete(fids, fid)
+		}
+		return rx, nil
+	}
+	switch tx.Type {
+	case plan9.Tauth:
+		return nil, fmt.Errorf("authentication not required")
+	case plan9.Tattach:
+		if fids[tx.Fid] != nil {
+			return nil, fmt.Errorf("fid in use")
+		}
+		fids[tx.Fid] = &fsysFid{}
+		rx.Qid = fs.qid(0)
+		return rx, nil
+	case plan9.Tflush:
+		// Requests are answered in order, so
+		// there is never one to flush.
+		return rx, nil
+	}
+	f := fids[tx.Fid]
+	if f == nil {
+		return nil, fmt.Errorf("unknown fid")
+	}
+	switch tx.Type {
+	case plan9.Twalk:
+		if f.open {
+			return nil, fmt.Errorf("fid is open")
+		}
+		if tx.Newfid != tx.Fid && fids[tx.Newfid] != nil {
+			return nil, fmt.Errorf("fid in use")
+		}
+		path := f.path
+		for i, name := range tx.Wname {
+			p, ok := fs.walk(path, name)
+			if !ok {
+				if i == 0 {
+					return nil, fmt.Errorf("file does not exist")
+				}
+				// Only part of the path exists.
+				return rx, nil
+			}
+			path = p
+			rx.Wqid = append(rx.Wqid, fs.qid(path))
+		}
+		fids[tx.Newfid] = &fsysFid{path: path}
+	case plan9.Topen:
+		if f.open {
+			return nil, fmt.Errorf("fid is open")
+		}
+		mode := tx.Mode & 3
+		switch {
+		case f.path == 0:
+			if mode != plan9.OREAD {
+				return nil, fmt.Errorf("is a directory")
+			}
+			var buf bytes.Buffer
+			for i := range fsysFiles {
+				d := fs.stat(uint64(i + 1))
+				b, _ := d.Bytes()
+				buf.Write(b)
+			}
+			f.data = buf.Bytes()
+		case fsysFiles[f.path-1] == "ctl":
+		default:
+			if mode != plan9.OREAD {
+				return nil, fmt.Errorf("permission denied")
+			}
+			data, err := fs.result(fsysFiles[f.path-1])
+			if err != nil {
+				return nil, err
+			}
+			f.data = data
+		}
+		f.open = true
+		rx.Qid = fs.qid(f.path)
+	case plan9.Tread:
+		if !f.open {
+			return nil, fmt.Errorf("fid not open")
+		}
+		data := f.data
+		if f.path != 0 && fsysFiles[f.path-1] == "ctl" {
+			data = fs.ctl()
+		}
+		if tx.Offset < uint64(len(data)) {
+			data = data[tx.Offset:]
+			if len(data) > int(tx.Count) {
+				data = data[:tx.Count]
+			}
+			rx.Data = data
+		}
+		if f.path == 0 {
+			// Directory reads must return whole entries.
+			rx.Data = wholeDirEntries(rx.Data)
+		}
+	case plan9.Twrite:
+		if !f.open || f.path == 0 || fsysFiles[f.path-1] != "ctl" {
+			return nil, fmt.Errorf("permission denied")
+		}
+		if err := fs.setQuery(string(tx.Data)); err != nil {
+			return nil, err
+		}
+		rx.Count = uint32(len(tx.Data))
+	case plan9.Tclunk:
+		delete(fids, tx.Fid)
+	case plan9.Tremove:
+		delete(fids, tx.Fid)
+		return nil, fmt.Errorf("permission denied")
+	case plan9.Tstat:
+		d := fs.stat(f.path)
+		rx.Stat, _ = d.Bytes()
+	default:
+		return nil, fmt.Errorf("permission denied")
+	}
+	return rx, nil
+}
+
+// walk returns the qid path of the file name in the directory
+// with the given qid path, and reports whether there is one.
+func (fs *godefFsys) walk(dir uint64, name string) (uint64, bool) {
+	if dir != 0 {
+		return 0, false
+	}
+	if name == ".." {
+		return 0, true
+	}
+	for i, f := range fsysFiles {
+		if f == name {
+			return uint64(i + 1), true
+		}
+	}
+	return 0, false
+}
+
+func (fs *godefFsys) qid(path uint64) plan9.Qid {
+	if path == 0 {
+		return plan9.Qid{Type: plan9.QTDIR}
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return plan9.Qid{Path: path, Vers: fs.vers}
+}
+
+func (fs *godefFsys) stat(path uint64) *plan9.Dir {
+	d := &plan9.Dir{
+		Qid:  fs.qid(path),
+		Uid:  "godef",
+		Gid:  "godef",
+		Muid: "godef",
+	}
+	switch {
+	case path == 0:
+		d.Name = "/"
+		d.Mode = plan9.DMDIR | 0555
+	case fsysFiles[path-1] == "ctl":
+		d.Name = "ctl"
+		d.Mode = 0666
+	default:
+		d.Name = fsysFiles[path-1]
+		d.Mode = 0444
+	}
+	return d
+}
+
+// wholeDirEntries returns the longest prefix of data
+// holding only complete directory entries.
+func wholeDirEntries(data []byte) []byte {
+	n := 0
+	for n+2 <= len(data) {
+		size := 2 + (int(data[n]) | int(data[n+1])<<8)
+		if n+size > len(data) {
+			break
+		}
+		n += size
+	}
+	return data[:n]
+}
+
+// ctl returns the contents of the ctl file.
+func (fs *godefFsys) ctl() []byte {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.query == "" {
+		return nil
+	}
+	return []byte(fs.query + "\n")
+}
+
+var queryPattern = regexp.MustCompile(`^(.+):#([0-9]+)$`)
+
+// setQuery sets the query to q, of the form "file:#offset",
+// discarding the results of the previous one.
+func (fs *godefFsys) setQuery(q string) error {
+	q = strings.TrimSpace(q)
+	m := queryPattern.FindStringSubmatch(q)
+	if m == nil {
+		return fmt.Errorf("bad query %q; want file:#offset", q)
+	}
+	filename, err := filepath.Abs(m[1])
+	if err != nil {
+		return err
+	}
+	offset, err := strconv.Atoi(m[2])
+	if err != nil {
+		return fmt.Errorf("bad offset in query %q", q)
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.query = q
+	fs.filename = filename
+	fs.offset = offset
+	fs.vers++
+	fs.results = make(map[string][]byte)
+	return nil
+}
+
+// result returns the contents of the named result
+// file for the current query.
+func (fs *godefFsys) result(name string) ([]byte, error) {
+	fs.mu.Lock()
+	query, filename, offset, vers := fs.query, fs.filename, fs.offset, fs.vers
+	data, ok := fs.results[name]
+	fs.mu.Unlock()
+	if query == "" {
+		return nil, fmt.Errorf("no query; write file:#offset to ctl")
+	}
+	if ok {
+		return data, nil
+	}
+	data, err := fs.compute(name, filename, offset)
+	if err != nil {
+		return nil, err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	// Keep the result only if the query has
+	// not changed while it was computed.
+	if fs.vers == vers {
+		fs.results[name] = data
+	}
+	return data, nil
+}
+
+// compute returns the contents of the named result file
+// for the identifier at the given rune offset in filename.
+func (fs *godefFsys) compute(name, filename string, offset int) ([]byte, error) {
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	searchpos := runeOffset2ByteOffset(src, offset)
+	pkgs, err := fs.load(filename)
+	if err != nil {
+		return nil, err
+	}
+	pkg, input := findSyntax(pkgs, filename)
+	if input == nil {
+		return nil, fmt.Errorf("no package found containing %s", filename)
+	}
+	var buf bytes.Buffer
+	switch name {
+	case "def", "type":
+		tfile := pkg.Fset.File(input.Pos())
+		if searchpos < 0 || searchpos > tfile.Size() {
+			return nil, fmt.Errorf("cursor %d is beyond end of file %s (%d)", searchpos, filename, tfile.Size())
+		}
+		m, err := findMatch(input, tfile.Pos(searchpos))
+		if err != nil {
+			return nil, err
+		}
+		gobj, err := matchObject(pkg, m, searchpos)
+		if err != nil {
+			return nil, err
+		}
+		obj, err := adaptPackagesObject(pkg.Fset, pkg.Types, gobj, filename, src)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case name == "type":
+			fmt.Fprintf(&buf, "%s\n", typeStr(obj))
+		case obj.Kind == PathKind:
+			fmt.Fprintf(&buf, "%s\n", obj.Value)
+		default:
+			fmt.Fprintf(&buf, "%v\n", obj.Position)
+		}
+	case "refs":
+		refs, err := packagesReferences(pkgs, filename, input, searchpos)
+		if err != nil {
+			return nil, err
+		}
+		if err := printReferences(&buf, refs); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// load returns the packages of the module containing filename,
+// including filename's own package, reusing those loaded for an
+// earlier query if none of the module's files has changed since.
+func (fs *godefFsys) load(filename string) ([]*packages.Package, error) {
+	root := moduleRoot(filepath.Dir(filename))
+	tests := strings.HasSuffix(filename, "_test.go")
+	fs.loadMu.Lock()
+	defer fs.loadMu.Unlock()
+	if l := fs.loaded; l != nil && l.root == root && l.tests == tests && l.current(filename) {
+		return l.pkgs, nil
+	}
+	fs.loaded = nil
+	cfg := &packages.Config{
+		Context: fs.ctx,
+		Dir:     root,
+		Mode:    packages.LoadSyntax | packages.NeedModule,
+		Tests:   tests,
+	}
+	pkgs, err := packages.Load(cfg, "./...", "file="+filename)
+	if err != nil {
+		return nil, err
+	}
+	l := &fsysPackages{
+		root:  root,
+		tests: tests,
+		pkgs:  pkgs,
+		files: make(map[string]os.FileInfo),
+	}
+	// Only the files of the main module are expected to change,
+	// and statting those of all its dependencies on every query
+	// would be costly.
+	for _, p := range pkgs {
+		if p.Module == nil || !p.Module.Main {
+			continue
+		}
+		for _, name := range p.CompiledGoFiles {
+			if fi, err := os.Stat(name); err == nil {
+				l.files[name] = fi
+			}
+		}
+	}
+	fs.loaded = l
+	return pkgs, nil
+}
+
+// current reports whether filename is one of the files of the
+// loaded module and none of its files has changed since
+// they were loaded.
+func (l *fsysPackages) current(filename string) bool {
+	if _, ok := l.files[filename]; !ok {
+		return false
+	}
+	for name, old := range l.files {
+		fi, err := os.Stat(name)
+		if err != nil || !fi.ModTime().Equal(old.ModTime()) || fi.Size() != old.Size() {
+			return false
+		}
+	}
+	return true
+}
+
+// findSyntax returns the syntax of the given file and
+// the package in pkgs containing it.
+func findSyntax(pkgs []*packages.Package, filename string) (*packages.Package, *ast.File) {
+	isInputFile := newFileCompare(filename)
+	for _, p := range pkgs {
+		for _, f := range p.Syntax {
+			if tf := p.Fset.File(f.Pos()); tf != nil && isInputFile(tf.Name()) {
+				return p, f
+			}
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"9fans.net/go/plan9"
+	"9fans.net/go/plan9/client"
+	"github.com/rogpeppe/godef/internal/testfiles"
+)
+
+var fsysTestFiles = map[string]string{
+	"go.mod": "module example.com/m\n",
+	"a/a.go": `package a
+
+// Ω is a type.
+type Ω struct {
+	N int
+}
+
+func f(x *Ω) int {
+	x.N++
+	return x.N
+}
+`,
+}
+
+func TestFsys(t *testing.T) {
+	dir := testfiles.Write(t, fsysTestFiles)
+	defer os.RemoveAll(dir)
+	c0, c1 := net.Pipe()
+	gfs := newGodefFsys(context.Background())
+	go gfs.serveConn(c0)
+	conn, err := client.NewConn(c1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fsys, err := conn.Attach(nil, "test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fid, err := fsys.Open("/", plan9.OREAD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(fid)
+	fid.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for len(data) > 0 {
+		n := 2 + (int(data[0]) | int(data[1])<<8)
+		d, err := plan9.UnmarshalDir(data[:n])
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, d.Name)
+		data = data[n:]
+	}
+	if got, want := strings.Join(names, " "), "ctl def type refs"; got != want {
+		t.Errorf("got directory entries %q; want %q", got, want)
+	}
+
+	read := func(name string) (string, error) {
+		fid, err := fsys.Open(name, plan9.OREAD)
+		if err != nil {
+			return "", err
+		}
+		defer fid.Close()
+		data, err := ioutil.ReadAll(fid)
+		return string(data), err
+	}
+	write := func(name, data string) error {
+		fid, err := fsys.Open(name, plan9.OWRITE)
+		if err != nil {
+			return err
+		}
+		defer fid.Close()
+		_, err = fid.Write([]byte(data))
+		return err
+	}
+	if _, err := read("def"); err == nil || !strings.Contains(err.Error(), "no query") {
+		t.Errorf("got error %v reading def before any query; want no query", err)
+	}
+	if err := write("ctl", "bad query"); err == nil {
+		t.Errorf("no error from bad query")
+	}
+	if err := write("def", "x"); err == nil {
+		t.Errorf("no error writing def")
+	}
+
+	// The offset is in runes, so Ω counts as one.
+	filename := filepath.Join(dir, "a", "a.go")
+	src := fsysTestFiles["a/a.go"]
+	offset := len([]rune(src[:strings.Index(src, "N++")]))
+	query := fmt.Sprintf("%s:#%d", filename, offset)
+	if err := write("ctl", query+"\n"); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name, want string
+	}{
+		{"ctl", query + "\n"},
+		{"def", filename + ":5:2\n"},
+		{"type", "N int\n"},
+		{"refs", filename + ":5:2-5:3\tdeclaration\n" +
+			filename + ":9:4-9:5\twrite\n" +
+			filename + ":10:11-10:12\tread\n"},
+	}
+	for _, test := range tests {
+		got, err := read(test.name)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s: got %q; want %q", test.name, got, test.want)
+		}
+	}
+	loaded := func() *fsysPackages {
+		gfs.loadMu.Lock()
+		defer gfs.loadMu.Unlock()
+		return gfs.loaded
+	}
+	first := loaded()
+	for name := range first.files {
+		if !strings.HasPrefix(name, dir+string(filepath.Separator)) {
+			t.Errorf("file %s outside the module is tracked", name)
+		}
+	}
+
+	// Another query in the same file reuses the packages.
+	offset = len([]rune(src[:strings.Index(src, "x *Ω")]))
+	if err := write("ctl", fmt.Sprintf("%s:#%d", filename, offset)); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := read("type"); err != nil || got != "x *Ω\n" {
+		t.Errorf("type: got %q, %v; want %q", got, err, "x *Ω\n")
+	}
+	if loaded() != first {
+		t.Errorf("packages loaded again for a query in an unchanged file")
+	}
+
+	// Changing the file causes the packages to be loaded again.
+	src = "package a\n\nconst C = 1\n" + src[len("package a\n"):]
+	if err := ioutil.WriteFile(filename, []byte(src), 0666); err != nil {
+		t.Fatal(err)
+	}
+	offset = len([]rune(src[:strings.Index(src, "N++")]))
+	if err := write("ctl", fmt.Sprintf("%s:#%d", filename, offset)); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := read("def"); err != nil || got != filename+":7:2\n" {
+		t.Errorf("def after changing the file: got %q, %v; want %q", got, err, filename+":7:2\n")
+	}
+	if loaded() == first {
+		t.Errorf("packages not loaded again after the file changed")
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// fuzzyScore reports how well pattern matches name. The characters
+// of pattern must appear in name in order, ignoring case; if they
+// do not, fuzzyScore returns -1. Matches that are contiguous, that
+// start at word boundaries or that cover more of name score higher.
+func fuzzyScore(pattern, name string) int {
+	p := []rune(pattern)
+	n := []rune(name)
+	if len(p) == 0 {
+		return 0
+	}
+	if len(p) > len(n) {
+		return -1
+	}
+	// best[i][j] holds the best score for matching p[:i+1]
+	// with p[i] matched at n[j], or -1 if there is no such match.
+	best := make([][]int, len(p))
+	for i := range best {
+		best[i] = make([]int, len(n))
+		for j := range best[i] {
+			best[i][j] = -1
+			if !equalFold(p[i], n[j]) {
+				continue
+			}
+			s := charScore(p[i], n, j)
+			if i == 0 {
+				if j == 0 {
+					s += 4
+				}
+				best[i][j] = s
+				continue
+			}
+			for k := i - 1; k < j; k++ {
+				prev := best[i-1][k]
+				if prev < 0 {
+					continue
+				}
+				t := prev + s
+				if k == j-1 {
+					// contiguous match
+					t += 3
+				}
+				if t > best[i][j] {
+					best[i][j] = t
+				}
+			}
+		}
+	}
+	score := -1
+	for _, s := range best[len(p)-1] {
+		if s > score {
+			score = s
+		}
+	}
+	if score < 0 {
+		return -1
+	}
+	// Prefer names that match exactly, or whose
+	// last dot-separated component matches exactly.
+	if strings.EqualFold(pattern, name) || strings.EqualFold(pattern, name[strings.LastIndex(name, ".")+1:]) {
+		score += 10
+	}
+	// Prefer shorter names when everything else is equal.
+	return score*16 - (len(n) - len(p))
+}
+
+// charScore returns the score for matching c against n[j].
+func charScore(c rune, n []rune, j int) int {
+	s := 1
+	if c == n[j] {
+		s++
+	}
+	if isWordStart(n, j) {
+		s += 5
+	}
+	return s
+}
+
+// isWordStart reports whether n[j] starts a word in a
+// mixed-caps or underscore or dot separated name.
+func isWordStart(n []rune, j int) bool {
+	if j == 0 {
+		return true
+	}
+	prev, c := n[j-1], n[j]
+	switch {
+	case prev == '_' || prev == '.' || prev == '/':
+		return true
+	case unicode.IsUpper(c) && !unicode.IsUpper(prev):
+		return true
+	}
+	return false
+}
+
+func equalFold(a, b rune) bool {
+	return a == b || unicode.ToLower(a) == unicode.ToLower(b)
+}
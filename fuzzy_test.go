@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+var fuzzyScoreTests = []struct {
+	pattern string
+	name    string
+	match   bool
+}{
+	{"fs", "FileSet", true},
+	{"FSet", "FileSet", true},
+	{"fileset", "FileSet", true},
+	{"exprtype", "ExprType", true},
+	{"T.M", "Type.Member", true},
+	{"sf", "FileSet", false},
+	{"FileSets", "FileSet", false},
+}
+
+func TestFuzzyScore(t *testing.T) {
+	for _, test := range fuzzyScoreTests {
+		score := fuzzyScore(test.pattern, test.name)
+		if (score >= 0) != test.match {
+			t.Errorf("fuzzyScore(%q, %q) = %d; want match %v", test.pattern, test.name, score, test.match)
+		}
+	}
+}
+
+var fuzzyOrderTests = []struct {
+	pattern       string
+	better, worse string
+}{
+	// exact matches beat partial ones
+	{"member", "Type.Member", "goMembers"},
+	// word starts beat matches in the middle of words
+	{"fs", "FileSet", "offset"},
+	// contiguous matches beat scattered ones
+	{"bat", "combat", "cobalt"},
+	// shorter names beat longer ones
+	{"pos", "Pos", "Position"},
+}
+
+func TestFuzzyScoreOrder(t *testing.T) {
+	for _, test := range fuzzyOrderTests {
+		better := fuzzyScore(test.pattern, test.better)
+		worse := fuzzyScore(test.pattern, test.worse)
+		if better <= worse {
+			t.Errorf("pattern %q: score %d for %q; want more than %d for %q", test.pattern, better, test.better, worse, test.worse)
+		}
+	}
+}
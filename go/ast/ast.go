@@ -221,6 +221,15 @@ type (
 		Rbrack token.Pos // position of "]"
 	}
 
+	// An IndexListExpr node represents an expression followed by
+	// multiple indices, as in the instantiation of a generic type.
+	IndexListExpr struct {
+		X       Expr      // expression
+		Lbrack  token.Pos // position of "["
+		Indices []Expr    // index expressions
+		Rbrack  token.Pos // position of "]"
+	}
+
 	// A SliceExpr node represents an expression followed by slice indices.
 	SliceExpr struct {
 		X      Expr      // expression
@@ -360,6 +369,7 @@ func (x *CompositeLit) Pos() token.Pos {
 func (x *ParenExpr) Pos() token.Pos      { return x.Lparen }
 func (x *SelectorExpr) Pos() token.Pos   { return x.X.Pos() }
 func (x *IndexExpr) Pos() token.Pos      { return x.X.Pos() }
+func (x *IndexListExpr) Pos() token.Pos  { return x.X.Pos() }
 func (x *SliceExpr) Pos() token.Pos      { return x.X.Pos() }
 func (x *TypeAssertExpr) Pos() token.Pos { return x.X.Pos() }
 func (x *CallExpr) Pos() token.Pos       { return x.Fun.Pos() }
@@ -382,13 +392,14 @@ func (x *Ellipsis) End() token.Pos {
 	}
 	return x.Ellipsis + 3 // len("...")
 }
-func (x *BasicLit) End() token.Pos     { return token.Pos(int(x.ValuePos) + len(x.Value)) }
-func (x *FuncLit) End() token.Pos      { return x.Body.End() }
-func (x *CompositeLit) End() token.Pos { return x.Rbrace + 1 }
-func (x *ParenExpr) End() token.Pos    { return x.Rparen + 1 }
-func (x *SelectorExpr) End() token.Pos { return x.Sel.End() }
-func (x *IndexExpr) End() token.Pos    { return x.Rbrack + 1 }
-func (x *SliceExpr) End() token.Pos    { return x.Rbrack + 1 }
+func (x *BasicLit) End() token.Pos      { return token.Pos(int(x.ValuePos) + len(x.Value)) }
+func (x *FuncLit) End() token.Pos       { return x.Body.End() }
+func (x *CompositeLit) End() token.Pos  { return x.Rbrace + 1 }
+func (x *ParenExpr) End() token.Pos     { return x.Rparen + 1 }
+func (x *SelectorExpr) End() token.Pos  { return x.Sel.End() }
+func (x *IndexExpr) End() token.Pos     { return x.Rbrack + 1 }
+func (x *IndexListExpr) End() token.Pos { return x.Rbrack + 1 }
+func (x *SliceExpr) End() token.Pos     { return x.Rbrack + 1 }
 func (x *TypeAssertExpr) End() token.Pos {
 	if x.Type != nil {
 		return x.Type.End()
@@ -424,6 +435,7 @@ func (x *CompositeLit) exprNode()   {}
 func (x *ParenExpr) exprNode()      {}
 func (x *SelectorExpr) exprNode()   {}
 func (x *IndexExpr) exprNode()      {}
+func (x *IndexListExpr) exprNode()  {}
 func (x *SliceExpr) exprNode()      {}
 func (x *TypeAssertExpr) exprNode() {}
 func (x *CallExpr) exprNode()       {}
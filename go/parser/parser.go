@@ -100,7 +100,7 @@ func (p *parser) init(fset *token.FileSet, filename string, src []byte, mode uin
 
 func naiveImportPathToName(path, _ string) (string, error) {
 	if i := strings.LastIndex(path, "/"); i >= 0 {
-		path = path[0:i]
+		path = path[i+1:]
 	}
 	return path, nil
 }
@@ -570,7 +570,36 @@ func (p *parser) parseTypeName() ast.Expr {
 		defer un(trace(p, "TypeName"))
 	}
 
-	return p.parseQualifiedIdent()
+	x := p.parseQualifiedIdent()
+	if _, ok := x.(*ast.SelectorExpr); ok && p.tok == token.LBRACK {
+		// Generic types can't be declared, but
+		// imported ones can be instantiated.
+		x = p.parseTypeArgs(x)
+	}
+	return x
+}
+
+func (p *parser) parseTypeArgs(x ast.Expr) ast.Expr {
+	if p.trace {
+		defer un(trace(p, "TypeArgs"))
+	}
+
+	lbrack := p.expect(token.LBRACK)
+	p.exprLev++
+	args := []ast.Expr{p.parseType()}
+	for p.tok == token.COMMA {
+		p.next()
+		if p.tok == token.RBRACK {
+			break
+		}
+		args = append(args, p.parseType())
+	}
+	p.exprLev--
+	rbrack := p.expect(token.RBRACK)
+	if len(args) == 1 {
+		return &ast.IndexExpr{x, lbrack, args[0], rbrack}
+	}
+	return &ast.IndexListExpr{x, lbrack, args, rbrack}
 }
 
 func (p *parser) parseArrayType(ellipsisOk bool) ast.Expr {
@@ -1112,6 +1141,20 @@ func (p *parser) parseIndexOrSlice(x ast.Expr) ast.Expr {
 	if p.tok != token.COLON {
 		index[0] = p.parseExpr()
 	}
+	if index[0] != nil && p.tok == token.COMMA {
+		// instantiation of a generic function or type
+		args := []ast.Expr{index[0]}
+		for p.tok == token.COMMA {
+			p.next()
+			if p.tok == token.RBRACK {
+				break
+			}
+			args = append(args, p.parseType())
+		}
+		p.exprLev--
+		rbrack := p.expect(token.RBRACK)
+		return &ast.IndexListExpr{X: x, Lbrack: lbrack, Indices: args, Rbrack: rbrack}
+	}
 	ncolons := 0
 	for p.tok == token.COLON && ncolons < len(index)-1 {
 		p.next()
@@ -1162,11 +1205,13 @@ func (p *parser) parseElement(keyOk bool) ast.Expr {
 		defer un(trace(p, "Element"))
 	}
 
+	var x ast.Expr
 	if p.tok == token.LBRACE {
-		return p.parseLiteralValue(nil)
+		// A literal with an elided type can also be a map key.
+		x = p.parseLiteralValue(nil)
+	} else {
+		x = p.parseExpr()
 	}
-
-	x := p.parseExpr()
 	if keyOk && p.tok == token.COLON {
 		colon := p.pos
 		p.next()
@@ -1219,6 +1264,7 @@ func (p *parser) checkExpr(x ast.Expr) ast.Expr {
 		panic("unreachable")
 	case *ast.SelectorExpr:
 	case *ast.IndexExpr:
+	case *ast.IndexListExpr:
 	case *ast.SliceExpr:
 	case *ast.TypeAssertExpr:
 		if t.Type == nil {
@@ -1769,7 +1815,9 @@ func (p *parser) parseCommClause() *ast.CommClause {
 			}
 			if lhs != nil {
 				stmt := &ast.AssignStmt{lhs, pos, tok, []ast.Expr{rhs}}
-				p.shortVarDecl(idents, stmt)
+				if tok == token.DEFINE {
+					p.shortVarDecl(idents, stmt)
+				}
 				comm = stmt
 			} else {
 				comm = &ast.ExprStmt{rhs}
@@ -2005,13 +2053,18 @@ func parseConstSpec(p *parser, doc *ast.CommentGroup, decl *ast.GenDecl, iota in
 	// the end of the innermost containing block.
 	// (Global identifiers are resolved in a separate phase after parsing.)
 	spec := &ast.ValueSpec{doc, idents, typ, values, p.lineComment}
+	var declNode ast.Node = spec
 	if values == nil {
 		// If there are no values, then use the complete
 		// GenDecl for the declaration, so that
 		// the expressions above can be found.
-		p.declare(decl, p.topScope, ast.Con, idents...)
-	} else {
-		p.declare(spec, p.topScope, ast.Con, idents...)
+		declNode = decl
+	}
+	p.declare(declNode, p.topScope, ast.Con, idents...)
+	for _, ident := range idents {
+		if ident.Obj != nil && ident.Obj.Decl == declNode {
+			ident.Obj.Data = iota
+		}
 	}
 
 	return spec
@@ -46,6 +46,7 @@ func init() {
 	// TODO(gri) provide "type"
 	declObj(ast.Fun, "append")
 	declObj(ast.Fun, "cap")
+	declObj(ast.Fun, "clear")
 	declObj(ast.Fun, "close")
 	declObj(ast.Fun, "complex")
 	declObj(ast.Fun, "copy")
@@ -53,6 +54,8 @@ func init() {
 	declObj(ast.Fun, "imag")
 	declObj(ast.Fun, "len")
 	declObj(ast.Fun, "make")
+	declObj(ast.Fun, "max")
+	declObj(ast.Fun, "min")
 	declObj(ast.Fun, "new")
 	declObj(ast.Fun, "panic")
 	declObj(ast.Fun, "panicln")
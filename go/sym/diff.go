@@ -0,0 +1,342 @@
+package sym
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Edit describes a change to the text of a file:
+// the bytes from offset Start up to offset End
+// are replaced with New.
+type Edit struct {
+	Filename string `json:"filename"`
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+	New      string `json:"new"`
+}
+
+// change holds the old and new contents of a file.
+type change struct {
+	name     string
+	old, new []byte
+}
+
+// changes reads the current contents of each of the given
+// files, which map filenames to their new contents, and returns
+// the changes sorted by filename.
+func changes(files map[string][]byte) ([]change, error) {
+	var cs []change
+	for name, newSrc := range files {
+		oldSrc, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		cs = append(cs, change{name, oldSrc, newSrc})
+	}
+	sort.Slice(cs, func(i, j int) bool {
+		return cs[i].name < cs[j].name
+	})
+	return cs, nil
+}
+
+// Diff writes to w a unified diff of the changes that
+// WriteFilesAtomic would make to the given files, which
+// map filenames to their new contents. Nothing is
+// written if any of the files cannot be read.
+func Diff(w io.Writer, files map[string][]byte) error {
+	cs, err := changes(files)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	for _, c := range cs {
+		unifiedDiff(&buf, c.name+".orig", c.name, SplitLines(c.old), SplitLines(c.new))
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// Edits returns the changes that WriteFilesAtomic would make
+// to the given files, which map filenames to their new contents,
+// as a list of edits sorted by filename and offset.
+func Edits(files map[string][]byte) ([]Edit, error) {
+	cs, err := changes(files)
+	if err != nil {
+		return nil, err
+	}
+	var edits []Edit
+	for _, c := range cs {
+		a, b := SplitLines(c.old), SplitLines(c.new)
+		offset := 0
+		var edit *Edit
+		for _, op := range diffLines(a, b) {
+			switch op.kind {
+			case ' ':
+				if edit != nil {
+					edits = append(edits, *edit)
+					edit = nil
+				}
+				offset += len(a[op.a])
+				continue
+			case '-':
+				if edit == nil {
+					edit = &Edit{Filename: c.name, Start: offset, End: offset}
+				}
+				offset += len(a[op.a])
+				edit.End = offset
+			case '+':
+				if edit == nil {
+					edit = &Edit{Filename: c.name, Start: offset, End: offset}
+				}
+				edit.New += b[op.b]
+			}
+		}
+		if edit != nil {
+			edits = append(edits, *edit)
+		}
+	}
+	return edits, nil
+}
+
+// WriteFilesAtomic writes the given files, which map filenames
+// to their new contents. Each one is written to a temporary file
+// that is renamed over the original only when all the temporary
+// files have been written, and the originals are kept in backup
+// files until all the renames have succeeded, so that either all
+// the files are changed or none of them is.
+func WriteFilesAtomic(files map[string][]byte) (err error) {
+	cs, err := changes(files)
+	if err != nil {
+		return err
+	}
+	var temps, backups []string
+	defer func() {
+		for _, name := range append(temps, backups...) {
+			os.Remove(name)
+		}
+	}()
+	for _, c := range cs {
+		temp, err := writeTemp(c.name, c.new)
+		if err != nil {
+			return fmt.Errorf("cannot write %q: %v", c.name, err)
+		}
+		temps = append(temps, temp)
+		backup, err := writeTemp(c.name, c.old)
+		if err != nil {
+			return fmt.Errorf("cannot back up %q: %v", c.name, err)
+		}
+		backups = append(backups, backup)
+	}
+	for i, c := range cs {
+		if err := os.Rename(temps[i], c.name); err != nil {
+			// Restore the files that have already been replaced.
+			for j := 0; j < i; j++ {
+				os.Rename(backups[j], cs[j].name)
+			}
+			return fmt.Errorf("cannot write %q: %v", c.name, err)
+		}
+	}
+	return nil
+}
+
+// writeTemp writes data to a new temporary file in the same
+// directory as name, with the same permissions as name,
+// and returns the name of the temporary file.
+func writeTemp(name string, data []byte) (string, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return "", err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name)+".")
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Chmod(info.Mode().Perm())
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// diffOp describes one line of a line-by-line diff. The kind
+// is ' ' for a line in both a and b, '-' for a line only in a
+// and '+' for a line only in b. The a and b fields hold the
+// line indexes in a and b where relevant.
+type diffOp struct {
+	kind byte
+	a, b int
+}
+
+// SplitLines splits data into lines, each of which
+// includes its trailing newline if there is one.
+func SplitLines(data []byte) []string {
+	var lines []string
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n') + 1
+		if i == 0 {
+			i = len(data)
+		}
+		lines = append(lines, string(data[:i]))
+		data = data[i:]
+	}
+	return lines
+}
+
+// diffLines returns the operations that turn a into b. It finds
+// a longest common subsequence of the lines that remain when
+// the common prefix and suffix are removed, which is cheap
+// when, as usual, only a few lines have changed.
+func diffLines(a, b []string) []diffOp {
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+	var ops []diffOp
+	for i := 0; i < pre; i++ {
+		ops = append(ops, diffOp{' ', i, i})
+	}
+	ma, mb := a[pre:len(a)-suf], b[pre:len(b)-suf]
+	// lcs[i][j] holds the length of the longest common
+	// subsequence of ma[i:] and mb[j:].
+	lcs := make([][]int, len(ma)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(mb)+1)
+	}
+	for i := len(ma) - 1; i >= 0; i-- {
+		for j := len(mb) - 1; j >= 0; j-- {
+			if ma[i] == mb[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(ma) || j < len(mb) {
+		switch {
+		case i < len(ma) && j < len(mb) && ma[i] == mb[j]:
+			ops = append(ops, diffOp{' ', pre + i, pre + j})
+			i++
+			j++
+		case j == len(mb) || i < len(ma) && lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', pre + i, -1})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', -1, pre + j})
+			j++
+		}
+	}
+	for k := suf; k > 0; k-- {
+		ops = append(ops, diffOp{' ', len(a) - k, len(b) - k})
+	}
+	return ops
+}
+
+// diffContext holds the number of unchanged lines
+// shown around each change in a unified diff.
+const diffContext = 3
+
+// unifiedDiff writes a unified diff from a to b to w.
+// It writes nothing if a and b are the same.
+func unifiedDiff(w io.Writer, aName, bName string, a, b []string) {
+	ops := diffLines(a, b)
+	first := true
+	for start := 0; start < len(ops); {
+		// Find the next change.
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+		// Extend the hunk until there are more than
+		// twice diffContext unchanged lines.
+		end := start
+		for same := 0; end < len(ops) && same <= 2*diffContext; end++ {
+			if ops[end].kind == ' ' {
+				same++
+			} else {
+				same = 0
+			}
+		}
+		for end > start && ops[end-1].kind == ' ' {
+			end--
+		}
+		lo, hi := start-diffContext, end+diffContext
+		if lo < 0 {
+			lo = 0
+		}
+		if hi > len(ops) {
+			hi = len(ops)
+		}
+		if first {
+			fmt.Fprintf(w, "--- %s\n+++ %s\n", aName, bName)
+			first = false
+		}
+		writeHunk(w, ops[lo:hi], a, b)
+		start = end
+	}
+}
+
+// writeHunk writes one hunk of a unified diff.
+func writeHunk(w io.Writer, ops []diffOp, a, b []string) {
+	aStart, bStart, aLen, bLen := -1, -1, 0, 0
+	for _, op := range ops {
+		if op.kind != '+' {
+			if aStart < 0 {
+				aStart = op.a
+			}
+			aLen++
+		}
+		if op.kind != '-' {
+			if bStart < 0 {
+				bStart = op.b
+			}
+			bLen++
+		}
+	}
+	fmt.Fprintf(w, "@@ -%s +%s @@\n", hunkRange(aStart, aLen), hunkRange(bStart, bLen))
+	for _, op := range ops {
+		line := ""
+		if op.kind == '+' {
+			line = b[op.b]
+		} else {
+			line = a[op.a]
+		}
+		fmt.Fprintf(w, "%c%s", op.kind, line)
+		if len(line) == 0 || line[len(line)-1] != '\n' {
+			fmt.Fprintf(w, "\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// hunkRange formats the start line and length of one side
+// of a hunk. Because each hunk includes the unchanged lines
+// around it, a side can only be empty if the file is empty.
+func hunkRange(start, n int) string {
+	switch n {
+	case 0:
+		return "0,0"
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, n)
+}
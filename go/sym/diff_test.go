@@ -0,0 +1,224 @@
+package sym
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const diffSrc = `package p
+
+// one
+// two
+// three
+// four
+
+func f() int {
+	x := 1
+	return x
+}
+
+// five
+// six
+// seven
+// eight
+// nine
+
+var y = 2
+`
+
+var diffWant = strings.Join([]string{
+	"@@ -6,8 +6,8 @@",
+	" // four",
+	" ",
+	" func f() int {",
+	"-\tx := 1",
+	"-\treturn x",
+	"+\trenamed := 1",
+	"+\treturn renamed",
+	" }",
+	" ",
+	" // five",
+	"@@ -16,4 +16,4 @@",
+	" // eight",
+	" // nine",
+	" ",
+	"-var y = 2",
+	"+var yy = 2",
+	"",
+}, "\n")
+
+// renameInFile parses the given source as a file in a temporary
+// directory and returns the new contents of the file when
+// every identifier with one of the given old names is renamed.
+func renameInFile(t *testing.T, src string, names map[string]string) (map[string][]byte, string) {
+	ctxt, f, filename := parseTestFile(t, src)
+	// renames maps the offset of each identifier
+	// to be renamed to its old name.
+	renames := make(map[int]string)
+	ctxt.IterateSyms(f, func(info *Info) bool {
+		if _, ok := names[info.Ident.Name]; ok {
+			renames[ctxt.FileSet.Position(info.Ident.Pos()).Offset] = info.Ident.Name
+		}
+		return true
+	})
+	var offsets []int
+	for off := range renames {
+		offsets = append(offsets, off)
+	}
+	sort.Ints(offsets)
+	var buf bytes.Buffer
+	last := 0
+	for _, off := range offsets {
+		buf.WriteString(src[last:off])
+		buf.WriteString(names[renames[off]])
+		last = off + len(renames[off])
+	}
+	buf.WriteString(src[last:])
+	return map[string][]byte{filename: buf.Bytes()}, filename
+}
+
+func TestDiff(t *testing.T) {
+	files, filename := renameInFile(t, diffSrc, map[string]string{"x": "renamed", "y": "yy"})
+	defer os.RemoveAll(filepath.Dir(filename))
+	var buf bytes.Buffer
+	if err := Diff(&buf, files); err != nil {
+		t.Fatal(err)
+	}
+	want := "--- " + filename + ".orig\n+++ " + filename + "\n" + diffWant
+	if got := buf.String(); got != want {
+		t.Errorf("unexpected diff; got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestEdits(t *testing.T) {
+	files, filename := renameInFile(t, diffSrc, map[string]string{"x": "renamed", "y": "yy"})
+	defer os.RemoveAll(filepath.Dir(filename))
+	edits, err := Edits(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(edits) != 2 {
+		t.Fatalf("got %d edits; want 2", len(edits))
+	}
+	// Apply the edits in reverse so that the offsets stay valid.
+	src := diffSrc
+	for i := len(edits) - 1; i >= 0; i-- {
+		e := edits[i]
+		if e.Filename != filename {
+			t.Errorf("edit %d has filename %q; want %q", i, e.Filename, filename)
+		}
+		src = src[:e.Start] + e.New + src[e.End:]
+	}
+	want := strings.NewReplacer("x := 1", "renamed := 1", "return x", "return renamed", "var y", "var yy").Replace(diffSrc)
+	if src != want {
+		t.Errorf("unexpected result of edits; got\n%s\nwant\n%s", src, want)
+	}
+}
+
+func TestWriteFilesAtomic(t *testing.T) {
+	files, filename := renameInFile(t, diffSrc, map[string]string{"y": "yy"})
+	dir := filepath.Dir(filename)
+	defer os.RemoveAll(dir)
+	if err := WriteFilesAtomic(files); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.Replace(diffSrc, "var y", "var yy", 1); string(data) != want {
+		t.Errorf("unexpected contents; got\n%s\nwant\n%s", data, want)
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 {
+		t.Errorf("temporary files left behind: %d files in directory", len(infos))
+	}
+}
+
+// exactSrc holds code that the legacy printer would not
+// reproduce: it drops the max index of a 3-index slice and
+// splits a one-line interface over several lines.
+const exactSrc = `package p
+
+type Named interface{ Name() string }
+
+func f(s []int, n Named) []int {
+	_ = n.Name()
+	return s[:len(s):len(s)]
+}
+`
+
+func TestChangesExact(t *testing.T) {
+	files, filename := renameInFile(t, exactSrc, map[string]string{"s": "xs"})
+	defer os.RemoveAll(filepath.Dir(filename))
+	want := strings.NewReplacer("s []int", "xs []int", "s[:len(s):len(s)]", "xs[:len(xs):len(xs)]").Replace(exactSrc)
+	if got := string(files[filename]); got != want {
+		t.Fatalf("unexpected new contents; got\n%s\nwant\n%s", got, want)
+	}
+	edits, err := Edits(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := exactSrc
+	for i := len(edits) - 1; i >= 0; i-- {
+		src = src[:edits[i].Start] + edits[i].New + src[edits[i].End:]
+	}
+	if src != want {
+		t.Errorf("unexpected result of edits; got\n%s\nwant\n%s", src, want)
+	}
+	if err := WriteFilesAtomic(files); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != want {
+		t.Errorf("unexpected contents; got\n%s\nwant\n%s", data, want)
+	}
+}
+
+func TestContextWriteFilesAtomic(t *testing.T) {
+	ctxt, f, filename := parseTestFile(t, diffSrc)
+	dir := filepath.Dir(filename)
+	defer os.RemoveAll(dir)
+	ctxt.IterateSyms(f, func(info *Info) bool {
+		if info.Ident.Name == "y" {
+			info.Ident.Name = "yy"
+		}
+		return true
+	})
+	want := strings.Replace(diffSrc, "var y", "var yy", 1)
+	var buf bytes.Buffer
+	if err := ctxt.Diff(&buf, ctxt.ChangedFiles); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "+var yy = 2\n") {
+		t.Errorf("unexpected diff; got\n%s", buf.String())
+	}
+	if err := ctxt.WriteFilesAtomic(ctxt.ChangedFiles); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != want {
+		t.Errorf("unexpected contents; got\n%s\nwant\n%s", data, want)
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 {
+		t.Errorf("temporary files left behind: %d files in directory", len(infos))
+	}
+}
@@ -0,0 +1,136 @@
+package sym
+
+import (
+	"fmt"
+	"go/build"
+	"path/filepath"
+	"strings"
+
+	"github.com/rogpeppe/godef/go/ast"
+	"github.com/rogpeppe/godef/go/parser"
+	"github.com/rogpeppe/godef/go/token"
+	"github.com/rogpeppe/godef/go/types"
+	"golang.org/x/tools/go/packages"
+)
+
+// Importer is used by a Context to find and parse packages.
+type Importer interface {
+	// Import parses the package with the given import path, as
+	// imported by a file in the directory srcDir, adding its
+	// files to fset. The package includes any test files
+	// that are in the same package. If some of the files
+	// cannot be parsed, Import returns the package without
+	// them, along with the first error.
+	Import(fset *token.FileSet, path, srcDir string) (*ast.Package, error)
+}
+
+// ImporterFunc is an adapter that allows an ordinary
+// function to be used as an Importer.
+type ImporterFunc func(fset *token.FileSet, path, srcDir string) (*ast.Package, error)
+
+func (f ImporterFunc) Import(fset *token.FileSet, path, srcDir string) (*ast.Package, error) {
+	return f(fset, path, srcDir)
+}
+
+// TypesImporter returns an Importer that imports packages with
+// the given types.Importer, such as types.DefaultImporter.
+// A types.Importer parses files into a file set of its own
+// choosing, so the Context's FileSet should be set to match
+// (types.FileSet in the case of types.DefaultImporter).
+func TypesImporter(imp types.Importer) Importer {
+	return ImporterFunc(func(fset *token.FileSet, path, srcDir string) (*ast.Package, error) {
+		if pkg := imp(path, srcDir); pkg != nil {
+			return pkg, nil
+		}
+		return nil, fmt.Errorf("cannot import %q", path)
+	})
+}
+
+// ModuleImporter is an Importer that uses the go command to find
+// packages, so import paths are resolved as they are by the go
+// command: in module mode, the go.mod file of the module containing
+// srcDir is used, with its replace directives and any vendor
+// directory; otherwise GOPATH is searched.
+type ModuleImporter struct {
+	// Env holds the environment for the go command.
+	// If it is nil, the current environment is used.
+	Env []string
+
+	// BuildFlags holds extra command line flags
+	// for the go command, such as -tags.
+	BuildFlags []string
+}
+
+func (imp *ModuleImporter) Import(fset *token.FileSet, path, srcDir string) (*ast.Package, error) {
+	cfg := &packages.Config{
+		Mode:       packages.NeedName | packages.NeedFiles,
+		Dir:        srcDir,
+		Env:        imp.Env,
+		BuildFlags: imp.BuildFlags,
+		Tests:      true,
+	}
+	if isStandard(path) {
+		// Standard library packages are found the same way
+		// in any mode, and go/build is much faster than
+		// running the go command.
+		if bpkg, err := build.Import(path, "", 0); err == nil && bpkg.Goroot {
+			var files []string
+			files = append(files, bpkg.GoFiles...)
+			files = append(files, bpkg.CgoFiles...)
+			files = append(files, bpkg.TestGoFiles...)
+			for i, f := range files {
+				files[i] = filepath.Join(bpkg.Dir, f)
+			}
+			return parsePackage(fset, path, bpkg.Name, files)
+		}
+	}
+	lpkgs, err := packages.Load(cfg, path)
+	if err != nil {
+		return nil, err
+	}
+	// With tests, the package may be loaded several times.
+	// Prefer the variant that includes the test files.
+	var lpkg *packages.Package
+	for _, p := range lpkgs {
+		if strings.HasSuffix(p.PkgPath, "_test") || strings.HasSuffix(p.PkgPath, ".test") {
+			continue
+		}
+		if lpkg == nil || strings.Contains(p.ID, " [") {
+			lpkg = p
+		}
+	}
+	if lpkg == nil {
+		return nil, fmt.Errorf("cannot find package %q", path)
+	}
+	if len(lpkg.GoFiles) == 0 {
+		if len(lpkg.Errors) > 0 {
+			return nil, lpkg.Errors[0]
+		}
+		return nil, fmt.Errorf("no Go files in package %q", path)
+	}
+	return parsePackage(fset, path, lpkg.Name, lpkg.GoFiles)
+}
+
+// parsePackage parses the files of the package with the given
+// import path and name.
+func parsePackage(fset *token.FileSet, path, name string, files []string) (*ast.Package, error) {
+	pkgs, err := parser.ParseFiles(fset, files, parser.ParseComments, nil)
+	pkg := pkgs[name]
+	if pkg == nil {
+		if err == nil {
+			err = fmt.Errorf("no files in package %q", path)
+		}
+		return nil, fmt.Errorf("cannot parse package %q: %v", path, err)
+	}
+	return pkg, err
+}
+
+// isStandard reports whether path is the import
+// path of a standard library package.
+func isStandard(path string) bool {
+	elem := path
+	if i := strings.Index(path, "/"); i >= 0 {
+		elem = path[:i]
+	}
+	return !strings.Contains(elem, ".") && !build.IsLocalImport(path)
+}
@@ -0,0 +1,96 @@
+package sym
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rogpeppe/godef/internal/testfiles"
+)
+
+var importerFiles = map[string]string{
+	"m/go.mod": `module example.com/m
+
+require example.com/r v0.0.0
+
+replace example.com/r => ../r
+`,
+	"m/m.go": `package m
+
+import "example.com/r"
+
+var X = r.Y
+`,
+	"m/m_test.go": `package m
+
+var Z = X
+`,
+	"n/go.mod": `module example.com/n
+
+require example.com/r v0.0.0
+
+replace example.com/r => ../r2
+`,
+	"n/n.go": `package n
+
+import "example.com/r"
+
+var X = r.Y
+`,
+	"r/go.mod": "module example.com/r\n",
+	"r/r.go": `package r
+
+var Y = 1
+`,
+	"r2/go.mod": "module example.com/r\n",
+	"r2/r.go": `package r
+
+var Y = 2
+`,
+}
+
+func TestModuleImporter(t *testing.T) {
+	dir := testfiles.Write(t, importerFiles)
+	defer os.RemoveAll(dir)
+	mdir := filepath.Join(dir, "m")
+	ctxt := NewContext()
+
+	pkg, err := ctxt.Import("example.com/m", mdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkg.Name != "m" || len(pkg.Files) != 2 {
+		t.Errorf("got package %q with %d files; want package m with 2 files", pkg.Name, len(pkg.Files))
+	}
+
+	// The replace directive is honoured.
+	pkg, err = ctxt.Import("example.com/r", mdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := pkg.Files[filepath.Join(dir, "r", "r.go")]; !ok {
+		t.Errorf("example.com/r not imported from the replacement directory")
+	}
+	if again, _ := ctxt.Import("example.com/r", mdir); again != pkg {
+		t.Errorf("package not cached")
+	}
+	// The same directory imported by a relative
+	// path gives the same package.
+	if rel, _ := ctxt.Import("../r", mdir); rel != pkg {
+		t.Errorf("package imported by relative path not shared")
+	}
+	// Another module may resolve the same
+	// import path to a different directory.
+	pkg, err = ctxt.Import("example.com/r", filepath.Join(dir, "n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := pkg.Files[filepath.Join(dir, "r2", "r.go")]; !ok {
+		t.Errorf("example.com/r not imported from the other module's replacement directory")
+	}
+
+	pkg, err = ctxt.Import("example.com/m/nonexistent", mdir)
+	if pkg != nil || err == nil {
+		t.Errorf("got package %v, error %v; want error", pkg, err)
+	}
+}
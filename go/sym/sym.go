@@ -6,6 +6,7 @@ import (
 	"bytes"
 	"fmt"
 	"go/build"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -27,86 +28,181 @@ type Info struct {
 	ExprType types.Type  // type of expression.
 	ReferPos token.Pos   // position of referred-to symbol.
 	ReferObj *ast.Object // object referred to.
-	Local    bool        // whether referred-to object is function-local.
+	Local    bool        // whether referred-to object is function-local (including parameters and labels).
 	Universe bool        // whether referred-to object is in universe.
 }
 
 // Context holds the context for IterateSyms.
 type Context struct {
-	pkgMutex     sync.Mutex
-	pkgCache     map[string]*ast.Package
+	pkgMutex sync.Mutex
+
+	// imports holds the packages imported so far, keyed by
+	// the import path and the module it was imported from.
+	imports map[importKey]*importedPackage
+
+	// pkgDirs holds the same packages keyed by the
+	// directory that holds them.
+	pkgDirs map[string]*ast.Package
+
+	// modRoots caches the result of moduleRoot.
+	modRoots map[string]string
+
 	importer     types.Importer
 	ChangedFiles map[string]*ast.File
 
 	// FileSet holds the fileset used when importing packages.
 	FileSet *token.FileSet
 
+	// Importer is used to find and parse imported packages.
+	// NewContext sets it to a ModuleImporter.
+	Importer Importer
+
 	// Logf is used to print warning messages.
 	// If it is nil, no warning messages will be printed.
 	Logf func(pos token.Pos, f string, a ...interface{})
 }
 
+// importKey identifies an import. An import path means the same
+// package when imported from anywhere in a module, so dir holds
+// the root of the module, or, for a relative import path, the
+// directory that it refers to.
+type importKey struct {
+	path, dir string
+}
+
+// importedPackage holds a package that is being, or has been, imported.
+type importedPackage struct {
+	// ready is closed when pkg and err have been set.
+	ready chan struct{}
+	pkg   *ast.Package
+	err   error
+}
+
 func NewContext() *Context {
 	ctxt := &Context{
-		pkgCache:     make(map[string]*ast.Package),
+		imports:      make(map[importKey]*importedPackage),
+		pkgDirs:      make(map[string]*ast.Package),
+		modRoots:     make(map[string]string),
 		FileSet:      token.NewFileSet(),
+		Importer:     &ModuleImporter{},
 		ChangedFiles: make(map[string]*ast.File),
 	}
 	ctxt.importer = ctxt.importerFunc()
 	return ctxt
 }
 
-// Import imports and parses the package with the given path.
-// It returns nil if it fails.
-func (ctxt *Context) Import(path, srcDir string) *ast.Package {
-	// TODO return error.
-	return ctxt.importer(path, srcDir)
-}
+// Import imports and parses the package with the given path,
+// as imported from a file in srcDir, using ctxt.Importer.
+// Packages are cached, so each is only imported once, and
+// a package found by different import paths is shared.
+// If some files in the package cannot be parsed, Import returns
+// the package without them along with the error.
+func (ctxt *Context) Import(path, srcDir string) (*ast.Package, error) {
+	if srcDir == "" {
+		srcDir, _ = os.Getwd() // TODO put this into Context?
+	}
+	ctxt.pkgMutex.Lock()
+	key := importKey{path, ctxt.moduleRoot(srcDir)}
+	if build.IsLocalImport(path) {
+		// Relative paths mean different packages
+		// in different directories.
+		key = importKey{dir: filepath.Join(srcDir, path)}
+	}
+	p := ctxt.imports[key]
+	if p != nil {
+		ctxt.pkgMutex.Unlock()
+		<-p.ready
+		return p.pkg, p.err
+	}
+	p = &importedPackage{
+		ready: make(chan struct{}),
+	}
+	ctxt.imports[key] = p
+	ctxt.pkgMutex.Unlock()
 
-func (ctxt *Context) importerFunc() types.Importer {
-	return func(path, srcDir string) *ast.Package {
+	pkg, err := ctxt.Importer.Import(ctxt.FileSet, path, srcDir)
+	if dir := packageDir(pkg); dir != "" {
 		ctxt.pkgMutex.Lock()
-		defer ctxt.pkgMutex.Unlock()
-		if pkg := ctxt.pkgCache[path]; pkg != nil {
-			return pkg
-		}
-		if srcDir == "" {
-			srcDir, _ = os.Getwd() // TODO put this into Context?
+		if q := ctxt.pkgDirs[dir]; q != nil {
+			pkg = q
+		} else {
+			ctxt.pkgDirs[dir] = pkg
 		}
-		bpkg, err := build.Import(path, srcDir, 0)
-		if err != nil {
-			ctxt.logf(token.NoPos, "cannot find %q: %v", path, err)
-			return nil
-		}
-		// Relative paths can have several names
-		if pkg := ctxt.pkgCache[bpkg.ImportPath]; pkg != nil {
-			ctxt.pkgCache[path] = pkg
-			return pkg
-		}
-		var files []string
-		files = append(files, bpkg.GoFiles...)
-		files = append(files, bpkg.CgoFiles...)
-		files = append(files, bpkg.TestGoFiles...)
-		for i, f := range files {
-			files[i] = filepath.Join(bpkg.Dir, f)
+		ctxt.pkgMutex.Unlock()
+	}
+	p.pkg, p.err = pkg, err
+	close(p.ready)
+	return pkg, err
+}
+
+// moduleRoot returns the directory holding the go.mod file
+// of the module containing dir, or the empty string if there
+// is none. It must be called with ctxt.pkgMutex held.
+func (ctxt *Context) moduleRoot(dir string) string {
+	if root, ok := ctxt.modRoots[dir]; ok {
+		return root
+	}
+	root := ""
+	for d := dir; ; {
+		if _, err := os.Stat(filepath.Join(d, "go.mod")); err == nil {
+			root = d
+			break
 		}
-		pkgs, err := parser.ParseFiles(ctxt.FileSet, files, parser.ParseComments, nil)
-		if len(pkgs) == 0 {
-			ctxt.logf(token.NoPos, "cannot parse package %q: %v", path, err)
-			return nil
+		parent := filepath.Dir(d)
+		if parent == d {
+			break
 		}
-		delete(pkgs, "documentation")
-		for _, pkg := range pkgs {
-			if ctxt.pkgCache[path] == nil {
-				ctxt.pkgCache[path] = pkg
-				if path != bpkg.ImportPath {
-					ctxt.pkgCache[bpkg.ImportPath] = pkg
-				}
-			} else {
-				ctxt.logf(token.NoPos, "unexpected extra package %q in %q", pkg.Name, path)
-			}
+		d = parent
+	}
+	ctxt.modRoots[dir] = root
+	return root
+}
+
+// packageDir returns the directory holding the
+// files of pkg, or the empty string if it has none.
+func packageDir(pkg *ast.Package) string {
+	if pkg == nil {
+		return ""
+	}
+	for name := range pkg.Files {
+		return filepath.Dir(name)
+	}
+	return ""
+}
+
+// TypesImporter returns a types.Importer that imports packages
+// with ctxt.Import, so that the type checker shares the
+// context's package cache. Errors are logged with ctxt.Logf.
+func (ctxt *Context) TypesImporter() types.Importer {
+	return ctxt.importer
+}
+
+// AddPackage adds pkg to the package cache, so that importing
+// path from the module containing pkg, or importing any other
+// path that refers to the directory holding it, will return it
+// rather than reading the package from disk.
+func (ctxt *Context) AddPackage(path string, pkg *ast.Package) {
+	ready := make(chan struct{})
+	close(ready)
+	dir := packageDir(pkg)
+	ctxt.pkgMutex.Lock()
+	defer ctxt.pkgMutex.Unlock()
+	ctxt.imports[importKey{path, ctxt.moduleRoot(dir)}] = &importedPackage{
+		ready: ready,
+		pkg:   pkg,
+	}
+	if dir != "" {
+		ctxt.pkgDirs[dir] = pkg
+	}
+}
+
+func (ctxt *Context) importerFunc() types.Importer {
+	return func(path, srcDir string) *ast.Package {
+		pkg, err := ctxt.Import(path, srcDir)
+		if err != nil {
+			ctxt.logf(token.NoPos, "cannot import %q: %v", path, err)
 		}
-		return ctxt.pkgCache[path]
+		return pkg
 	}
 }
 
@@ -123,7 +219,10 @@ func (ctxt *Context) logf(pos token.Pos, f string, a ...interface{}) {
 func (ctxt *Context) IterateSyms(f *ast.File, visitf func(info *Info) bool) {
 	var visit astVisitor
 	ok := true
-	local := false // TODO set to true inside function body
+	funcs := funcRanges(f)
+	// lits holds the composite literals enclosing
+	// the current node, outermost first.
+	var lits []*ast.CompositeLit
 	visit = func(n ast.Node) bool {
 		if !ok {
 			return false
@@ -161,30 +260,43 @@ func (ctxt *Context) IterateSyms(f *ast.File, visitf func(info *Info) bool) {
 					Sel: n.Name,
 				}
 			}
-			ok = ctxt.visitExpr(f, e, false, visitf)
-			local = true
+			ok = ctxt.visitExpr(f, e, nil, funcs, visitf)
 			ast.Walk(visit, n.Type)
 			if n.Body != nil {
 				ast.Walk(visit, n.Body)
 			}
-			local = false
 			return false
 
 		case *ast.Ident:
-			ok = ctxt.visitExpr(f, n, local, visitf)
+			ok = ctxt.visitExpr(f, n, nil, funcs, visitf)
+			return false
+
+		case *ast.CompositeLit:
+			if n.Type != nil {
+				ast.Walk(visit, n.Type)
+			}
+			lits = append(lits, n)
+			for _, e := range n.Elts {
+				ast.Walk(visit, e)
+			}
+			lits = lits[:len(lits)-1]
 			return false
 
 		case *ast.KeyValueExpr:
-			// don't try to resolve the key part of a key-value
-			// because it might be a map key which doesn't
-			// need resolving, and we can't tell without being
-			// complicated with types.
+			// The key might be a struct field name or an
+			// ordinary expression, depending on the type
+			// of the enclosing literal.
+			if id, isIdent := n.Key.(*ast.Ident); isIdent && len(lits) > 0 {
+				ok = ctxt.visitExpr(f, id, lits, funcs, visitf)
+			} else {
+				ast.Walk(visit, n.Key)
+			}
 			ast.Walk(visit, n.Value)
 			return false
 
 		case *ast.SelectorExpr:
 			ast.Walk(visit, n.X)
-			ok = ctxt.visitExpr(f, n, local, visitf)
+			ok = ctxt.visitExpr(f, n, nil, funcs, visitf)
 			return false
 
 		case *ast.File:
@@ -199,11 +311,56 @@ func (ctxt *Context) IterateSyms(f *ast.File, visitf func(info *Info) bool) {
 	ast.Walk(visit, f)
 }
 
+// posRange holds the range of source from pos up to end.
+type posRange struct {
+	pos, end token.Pos
+}
+
+// funcRanges returns the ranges of f that hold function-local
+// declarations: the receivers, parameters, results and bodies
+// of all the functions in f, including function literals.
+// Function names are not included because they are not local.
+func funcRanges(f *ast.File) []posRange {
+	var ranges []posRange
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			if n.Recv != nil {
+				ranges = append(ranges, posRange{n.Recv.Pos(), n.Recv.End()})
+			}
+			ranges = append(ranges, posRange{n.Type.Params.Pos(), n.End()})
+			// Function literals inside are covered already.
+			return false
+		case *ast.FuncLit:
+			ranges = append(ranges, posRange{n.Pos(), n.End()})
+			return false
+		}
+		return true
+	})
+	return ranges
+}
+
+// isLocal reports whether pos lies within any of the given ranges.
+func isLocal(pos token.Pos, ranges []posRange) bool {
+	for _, r := range ranges {
+		if r.pos <= pos && pos < r.end {
+			return true
+		}
+	}
+	return false
+}
+
 func (ctxt *Context) filename(f *ast.File) string {
 	return ctxt.FileSet.Position(f.Package).Filename
 }
 
-func (ctxt *Context) visitExpr(f *ast.File, e ast.Expr, local bool, visitf func(*Info) bool) bool {
+// visitExpr calls visitf with information on e. If lits is not
+// empty, e is the key of an element of the last of the enclosing
+// composite literals lits. Objects declared within any of the
+// function ranges funcs of f are local; because local objects
+// cannot be referred to from outside the file that declares them,
+// that is sufficient to determine Info.Local.
+func (ctxt *Context) visitExpr(f *ast.File, e ast.Expr, lits []*ast.CompositeLit, funcs []posRange, visitf func(*Info) bool) bool {
 	var info Info
 	info.Expr = e
 	switch e := e.(type) {
@@ -217,7 +374,7 @@ func (ctxt *Context) visitExpr(f *ast.File, e ast.Expr, local bool, visitf func(
 		info.Pos = e.Sel.Pos()
 		info.Ident = e.Sel
 	}
-	obj, t := types.ExprType(e, ctxt.importer, ctxt.FileSet)
+	obj, t := ctxt.exprType(e, lits)
 	if obj == nil {
 		ctxt.logf(e.Pos(), "no object for %s", pretty(e))
 		return true
@@ -236,7 +393,7 @@ func (ctxt *Context) visitExpr(f *ast.File, e ast.Expr, local bool, visitf func(
 	} else {
 		info.Universe = true
 	}
-	info.Local = local
+	info.Local = isLocal(info.ReferPos, funcs)
 	oldName := info.Ident.Name
 	more := visitf(&info)
 	if info.Ident.Name != oldName {
@@ -245,6 +402,23 @@ func (ctxt *Context) visitExpr(f *ast.File, e ast.Expr, local bool, visitf func(
 	return more
 }
 
+// exprType is like types.ExprType except that it logs
+// a warning rather than panicking if e cannot be resolved.
+// If lits is not empty, e is resolved as a composite
+// literal key with types.KeyField.
+func (ctxt *Context) exprType(e ast.Expr, lits []*ast.CompositeLit) (obj *ast.Object, t types.Type) {
+	defer func() {
+		if err := recover(); err != nil {
+			ctxt.logf(e.Pos(), "cannot resolve %s: %v", pretty(e), err)
+			obj, t = nil, types.Type{}
+		}
+	}()
+	if id, ok := e.(*ast.Ident); ok && len(lits) > 0 {
+		return types.KeyField(lits, id, ctxt.importer, ctxt.FileSet)
+	}
+	return types.ExprType(e, ctxt.importer, ctxt.FileSet)
+}
+
 // WriteFiles writes the given files, formatted as with gofmt.
 func (ctxt *Context) WriteFiles(files map[string]*ast.File) error {
 	// TODO should we try to continue changing files even after an error?
@@ -262,6 +436,53 @@ func (ctxt *Context) WriteFiles(files map[string]*ast.File) error {
 	return nil
 }
 
+// formatFiles returns the contents of the given files, formatted
+// as with gofmt, keyed by filename. It returns an error if any
+// of the files cannot be formatted.
+func (ctxt *Context) formatFiles(files map[string]*ast.File) (map[string][]byte, error) {
+	srcs := make(map[string][]byte)
+	for _, f := range files {
+		name := ctxt.filename(f)
+		src, err := ctxt.gofmtFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("cannot format %q: %v", name, err)
+		}
+		srcs[name] = src
+	}
+	return srcs, nil
+}
+
+// Diff writes to w a unified diff of the changes that
+// WriteFilesAtomic would make to the given files.
+func (ctxt *Context) Diff(w io.Writer, files map[string]*ast.File) error {
+	srcs, err := ctxt.formatFiles(files)
+	if err != nil {
+		return err
+	}
+	return Diff(w, srcs)
+}
+
+// Edits returns the changes that WriteFilesAtomic would make
+// to the given files as a list of edits.
+func (ctxt *Context) Edits(files map[string]*ast.File) ([]Edit, error) {
+	srcs, err := ctxt.formatFiles(files)
+	if err != nil {
+		return nil, err
+	}
+	return Edits(srcs)
+}
+
+// WriteFilesAtomic is like WriteFiles except that all the files
+// are formatted before any is written, and either all the files
+// are changed or none of them is.
+func (ctxt *Context) WriteFilesAtomic(files map[string]*ast.File) error {
+	srcs, err := ctxt.formatFiles(files)
+	if err != nil {
+		return err
+	}
+	return WriteFilesAtomic(srcs)
+}
+
 // litToString converts from a string literal to a regular string.
 func litToString(lit *ast.BasicLit) (v string) {
 	if lit.Kind != token.STRING {
@@ -0,0 +1,138 @@
+package sym
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rogpeppe/godef/go/ast"
+	"github.com/rogpeppe/godef/go/parser"
+	"github.com/rogpeppe/godef/internal/testfiles"
+)
+
+// parseTestFile parses the given source as a file
+// in a new temporary directory.
+func parseTestFile(t *testing.T, src string) (*Context, *ast.File, string) {
+	dir := testfiles.Write(t, map[string]string{"p.go": src})
+	filename := filepath.Join(dir, "p.go")
+	ctxt := NewContext()
+	f, err := parser.ParseFile(ctxt.FileSet, filename, nil, parser.ParseComments, ast.NewScope(parser.Universe), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ctxt, f, filename
+}
+
+const localSrc = `package p
+
+var global = 1
+
+var closure = func(param int) int {
+	inClosure := param + global
+	return inClosure
+}
+
+type T struct {
+	field int
+}
+
+func (recv T) Method(arg int) (result int) {
+	local := recv.field + arg + global
+	f := func() int {
+		nested := local
+		return nested
+	}
+	type localType struct {
+		localField int
+	}
+	result = localType{}.localField + f()
+	return
+}
+
+func loop() {
+outer:
+	for {
+		break outer
+	}
+}
+`
+
+// localWant maps the name of each identifier in localSrc to whether
+// the object it refers to is local.
+var localWant = map[string]bool{
+	"global":     false,
+	"closure":    false,
+	"param":      true,
+	"inClosure":  true,
+	"T":          false,
+	"field":      false,
+	"recv":       true,
+	"Method":     false,
+	"arg":        true,
+	"result":     true,
+	"local":      true,
+	"f":          true,
+	"nested":     true,
+	"localType":  true,
+	"localField": true,
+	"loop":       false,
+	"outer":      true,
+}
+
+func TestLocal(t *testing.T) {
+	ctxt, f, filename := parseTestFile(t, localSrc)
+	defer os.RemoveAll(filepath.Dir(filename))
+	seen := make(map[string]bool)
+	ctxt.IterateSyms(f, func(info *Info) bool {
+		name := info.Ident.Name
+		want, ok := localWant[name]
+		if !ok {
+			return true
+		}
+		seen[name] = true
+		if info.Local != want {
+			t.Errorf("%v: %s has Local %v; want %v", ctxt.FileSet.Position(info.Pos), name, info.Local, want)
+		}
+		return true
+	})
+	var missing []string
+	for name := range localWant {
+		if !seen[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		t.Errorf("identifiers not visited: %s", strings.Join(missing, ", "))
+	}
+}
+
+const keySrc = `package p
+
+type T struct {
+	Name string
+}
+
+var Name = "x"
+
+var _ = []T{{Name: Name}}
+var _ = map[string]T{Name: {Name: Name}}
+`
+
+func TestCompositeLitKeys(t *testing.T) {
+	ctxt, f, filename := parseTestFile(t, keySrc)
+	defer os.RemoveAll(filepath.Dir(filename))
+	var got []string
+	ctxt.IterateSyms(f, func(info *Info) bool {
+		if info.Ident.Name == "Name" {
+			got = append(got, ctxt.FileSet.Position(info.ReferPos).String())
+		}
+		return true
+	})
+	field := filename + ":4:2"
+	global := filename + ":7:5"
+	want := []string{field, global, field, global, global, field, global}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("got references\n\t%s\nwant\n\t%s", strings.Join(got, "\n\t"), strings.Join(want, "\n\t"))
+	}
+}
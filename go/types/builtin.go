@@ -0,0 +1,142 @@
+package types
+
+import (
+	"github.com/rogpeppe/godef/go/ast"
+)
+
+// builtinCall returns the type of the call n
+// to the predeclared function obj.
+func (ctxt *exprTypeContext) builtinCall(obj *ast.Object, n *ast.CallExpr, pkg string) Type {
+	argType := func(i int) Type {
+		if i >= len(n.Args) {
+			return badType
+		}
+		_, t := ctxt.exprType(n.Args[i], false, pkg)
+		return t
+	}
+	switch obj.Name {
+	case "make":
+		if len(n.Args) > 0 {
+			return ctxt.certify(n.Args[0], ast.Var, pkg)
+		}
+
+	case "new":
+		if len(n.Args) > 0 {
+			t := ctxt.certify(n.Args[0], ast.Var, pkg)
+			if t.Kind != ast.Bad {
+				return ctxt.newType(&ast.StarExpr{n.Pos(), t.Node.(ast.Expr)}, ast.Var, t.Pkg)
+			}
+		}
+
+	case "append":
+		// The result has the type of the slice.
+		if t := argType(0); t.Kind != ast.Bad {
+			t.Kind = ast.Var
+			return t
+		}
+
+	case "len", "cap":
+		kind := ast.Var
+		if argType(0).Kind == ast.Con {
+			kind = ast.Con
+		}
+		return ctxt.newType(predecl("int"), kind, "")
+
+	case "copy":
+		return ctxt.newType(predecl("int"), ast.Var, "")
+
+	case "min", "max":
+		// The result has the type of the arguments, where
+		// constant arguments take the type of any others.
+		result := badType
+		for i := range n.Args {
+			t := argType(i)
+			if t.Kind != ast.Bad && (result.Kind == ast.Bad || result.Kind == ast.Con && t.Kind != ast.Con) {
+				result = t
+			}
+		}
+		return result
+
+	case "complex":
+		x, y := argType(0), argType(1)
+		kind := ast.Var
+		if x.Kind == ast.Con && y.Kind == ast.Con {
+			kind = ast.Con
+		}
+		name := "complex128"
+		if isBasic(x, "float32") || isBasic(y, "float32") {
+			name = "complex64"
+		}
+		return ctxt.newType(predecl(name), kind, "")
+
+	case "real", "imag":
+		x := argType(0)
+		kind := ast.Var
+		if x.Kind == ast.Con {
+			kind = ast.Con
+		}
+		name := "float64"
+		if isBasic(x, "complex64") {
+			name = "float32"
+		}
+		return ctxt.newType(predecl(name), kind, "")
+
+	case "recover":
+		return ctxt.newType(&ast.InterfaceType{n.Pos(), &ast.FieldList{Opening: n.Lparen, Closing: n.Rparen}, false}, ast.Var, "")
+	}
+	// The other builtins have no result.
+	return badType
+}
+
+// unsafeCall returns the type of the call n if it is a call to
+// unsafe.Slice or unsafe.SliceData, whose declarations use
+// placeholder types. It reports whether it is such a call.
+func (ctxt *exprTypeContext) unsafeCall(n *ast.CallExpr, pkg string) (Type, bool) {
+	sel, ok := n.Fun.(*ast.SelectorExpr)
+	if !ok || selectorPkg(sel) != "unsafe" || sel.Sel.Name != "Slice" && sel.Sel.Name != "SliceData" {
+		return badType, false
+	}
+	if len(n.Args) == 0 {
+		return badType, true
+	}
+	_, t := ctxt.exprType(n.Args[0], false, pkg)
+	if t.Kind == ast.Bad {
+		return badType, true
+	}
+	u := t.Underlying(true)
+	switch x := u.Node.(type) {
+	case *ast.StarExpr:
+		// unsafe.Slice(ptr *T, len) []T
+		if sel.Sel.Name == "Slice" {
+			return ctxt.certify(&ast.ArrayType{n.Lparen, nil, x.X}, ast.Var, u.Pkg), true
+		}
+	case *ast.ArrayType:
+		// unsafe.SliceData(slice []T) *T
+		if sel.Sel.Name == "SliceData" && x.Len == nil {
+			return ctxt.certify(&ast.StarExpr{n.Lparen, x.Elt}, ast.Var, u.Pkg), true
+		}
+	}
+	return badType, true
+}
+
+// isBasic reports whether the predeclared type
+// underlying t has the given name.
+func isBasic(t Type, name string) bool {
+	id := basicType(t)
+	return id != nil && id.Name == name
+}
+
+// selectorPkg returns the import path of the package
+// that sel selects from, or the empty string if
+// sel is not a qualified identifier.
+func selectorPkg(sel *ast.SelectorExpr) string {
+	id, ok := sel.X.(*ast.Ident)
+	if !ok || id.Obj == nil || id.Obj.Kind != ast.Pkg {
+		return ""
+	}
+	spec, ok := id.Obj.Decl.(*ast.ImportSpec)
+	if !ok {
+		return ""
+	}
+	return litToString(spec.Path)
+}
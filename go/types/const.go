@@ -0,0 +1,317 @@
+package types
+
+import (
+	"go/constant"
+	gotoken "go/token"
+
+	"github.com/rogpeppe/godef/go/ast"
+	"github.com/rogpeppe/godef/go/parser"
+	"github.com/rogpeppe/godef/go/token"
+)
+
+// ConstValue returns the value of the constant represented by obj.
+// The declaration is evaluated as the compiler would: iota, implicitly
+// repeated expressions in constant declarations, arithmetic on typed
+// and untyped constants, string concatenation, conversions and len
+// of constant strings are all supported. It returns nil if obj is
+// not a constant or its value cannot be determined.
+func ConstValue(obj *ast.Object, importer Importer, fs *token.FileSet) constant.Value {
+	return constValueOf(&exprTypeContext{
+		importer: importer,
+		fileSet:  fs,
+		debug:    Debug,
+		panic:    Panic,
+	}, obj)
+}
+
+func constValueOf(ctxt *exprTypeContext, obj *ast.Object) constant.Value {
+	e := &constEvaluator{
+		ctxt:     ctxt,
+		visiting: make(map[*ast.Object]bool),
+	}
+	return e.object(obj).val
+}
+
+// constValue holds a constant value and the name of its basic
+// type, which is empty for untyped constants. The value is
+// nil if it is unknown.
+type constValue struct {
+	val constant.Value
+	typ string
+}
+
+var unknownConst = constValue{}
+
+type constEvaluator struct {
+	ctxt *exprTypeContext
+
+	// visiting holds the constants being evaluated,
+	// so that invalid recursive declarations
+	// do not recurse forever.
+	visiting map[*ast.Object]bool
+}
+
+// object returns the value of the constant obj.
+func (e *constEvaluator) object(obj *ast.Object) constValue {
+	switch {
+	case obj == nil:
+		return unknownConst
+	case obj == trueIdent.Obj:
+		return constValue{constant.MakeBool(true), ""}
+	case obj == falseIdent.Obj:
+		return constValue{constant.MakeBool(false), ""}
+	case obj.Kind != ast.Con || e.visiting[obj]:
+		return unknownConst
+	}
+	e.visiting[obj] = true
+	defer delete(e.visiting, obj)
+
+	var expr, typ ast.Expr
+	iota, _ := obj.Data.(int)
+	switch decl := obj.Decl.(type) {
+	case *ast.ValueSpec:
+		expr, typ = specValue(decl, decl, obj)
+	case *ast.GenDecl:
+		// The constant is declared without a value, so
+		// it repeats the last expression in the declaration.
+		var last *ast.ValueSpec
+		for i, spec := range decl.Specs {
+			vspec := spec.(*ast.ValueSpec)
+			if len(vspec.Values) > 0 {
+				last = vspec
+			}
+			if last == nil {
+				continue
+			}
+			if expr, typ = specValue(vspec, last, obj); expr != nil {
+				iota = i
+				break
+			}
+		}
+	}
+	if expr == nil {
+		return unknownConst
+	}
+	c := e.expr(expr, iota)
+	if typ != nil {
+		c = e.convert(c, typ)
+	}
+	return c
+}
+
+// specValue returns the expression and type that give the value
+// of obj if it is declared in spec, taking the values from
+// the spec last, which holds the most recent values.
+func specValue(spec, last *ast.ValueSpec, obj *ast.Object) (expr, typ ast.Expr) {
+	for i, name := range spec.Names {
+		if name.Obj == obj && i < len(last.Values) {
+			return last.Values[i], last.Type
+		}
+	}
+	return nil, nil
+}
+
+// expr returns the value of the constant expression x,
+// which is in a constant declaration with the given iota.
+func (e *constEvaluator) expr(x ast.Expr, iota int) constValue {
+	switch x := x.(type) {
+	case *ast.BasicLit:
+		kind, ok := litKinds[x.Kind]
+		if !ok {
+			return unknownConst
+		}
+		return constValue{constant.MakeFromLiteral(string(x.Value), kind, 0), ""}
+
+	case *ast.ParenExpr:
+		return e.expr(x.X, iota)
+
+	case *ast.Ident:
+		if x.Obj == iotaIdent.Obj {
+			return constValue{constant.MakeInt64(int64(iota)), ""}
+		}
+		return e.object(x.Obj)
+
+	case *ast.SelectorExpr:
+		obj, _ := e.ctxt.exprType(x, false, "")
+		return e.object(obj)
+
+	case *ast.UnaryExpr:
+		c := e.expr(x.X, iota)
+		op, ok := constOps[x.Op]
+		if c.val == nil || !ok {
+			return unknownConst
+		}
+		return constValue{constant.UnaryOp(op, c.val, unsignedBits[c.typ]), c.typ}
+
+	case *ast.BinaryExpr:
+		return e.binary(x, iota)
+
+	case *ast.CallExpr:
+		if len(x.Args) != 1 {
+			return unknownConst
+		}
+		arg := e.expr(x.Args[0], iota)
+		if arg.val == nil {
+			return unknownConst
+		}
+		if exprName(x.Fun) == parser.Universe.Lookup("len") {
+			if arg.val.Kind() != constant.String {
+				return unknownConst
+			}
+			return constValue{constant.MakeInt64(int64(len(constant.StringVal(arg.val)))), "int"}
+		}
+		return e.convert(arg, x.Fun)
+	}
+	return unknownConst
+}
+
+func (e *constEvaluator) binary(x *ast.BinaryExpr, iota int) constValue {
+	cx, cy := e.expr(x.X, iota), e.expr(x.Y, iota)
+	op, ok := constOps[x.Op]
+	if cx.val == nil || cy.val == nil || !ok {
+		return unknownConst
+	}
+	switch op {
+	case gotoken.SHL, gotoken.SHR:
+		s, ok := constant.Uint64Val(constant.ToInt(cy.val))
+		xv := constant.ToInt(cx.val)
+		if !ok || xv.Kind() != constant.Int {
+			return unknownConst
+		}
+		return e.typed(constant.Shift(xv, op, uint(s)), cx.typ)
+
+	case gotoken.EQL, gotoken.NEQ, gotoken.LSS, gotoken.LEQ, gotoken.GTR, gotoken.GEQ:
+		return constValue{constant.MakeBool(constant.Compare(cx.val, op, cy.val)), ""}
+	}
+	typ := cx.typ
+	if typ == "" {
+		typ = cy.typ
+	}
+	if op == gotoken.QUO && cx.val.Kind() == constant.Int && cy.val.Kind() == constant.Int {
+		if constant.Sign(cy.val) == 0 {
+			return unknownConst
+		}
+		// Division of integers truncates.
+		op = gotoken.QUO_ASSIGN
+	}
+	if op == gotoken.REM && constant.Sign(cy.val) == 0 {
+		return unknownConst
+	}
+	if cx.val.Kind() != cy.val.Kind() && (cx.val.Kind() == constant.String || cy.val.Kind() == constant.String) {
+		return unknownConst
+	}
+	return e.typed(constant.BinaryOp(cx.val, op, cy.val), typ)
+}
+
+// typed returns v with the given type,
+// converting it if the type needs that.
+func (e *constEvaluator) typed(v constant.Value, typ string) constValue {
+	if typ == "" {
+		return constValue{v, ""}
+	}
+	return convertBasic(constValue{v, typ}, typ)
+}
+
+// convert returns the value of c converted to the type denoted by t.
+func (e *constEvaluator) convert(c constValue, t ast.Expr) constValue {
+	if c.val == nil {
+		return unknownConst
+	}
+	_, typ := e.ctxt.exprType(t, false, "")
+	if typ.Kind != ast.Typ {
+		return unknownConst
+	}
+	id := basicType(typ)
+	if id == nil {
+		return unknownConst
+	}
+	return convertBasic(c, id.Name)
+}
+
+// convertBasic returns c converted to the named basic type.
+func convertBasic(c constValue, typ string) constValue {
+	v := c.val
+	switch typ {
+	case "int", "int8", "int16", "int32", "int64",
+		"uint", "uint8", "uint16", "uint32", "uint64", "uintptr":
+		v = constant.ToInt(v)
+		if v.Kind() != constant.Int {
+			return unknownConst
+		}
+	case "float", "float32", "float64":
+		v = constant.ToFloat(v)
+		if v.Kind() != constant.Float {
+			return unknownConst
+		}
+	case "complex64", "complex128":
+		v = constant.ToComplex(v)
+		if v.Kind() != constant.Complex {
+			return unknownConst
+		}
+	case "string":
+		if v.Kind() == constant.Int {
+			// Conversion from an integer gives
+			// the UTF-8 encoding of the rune.
+			r, ok := constant.Int64Val(v)
+			if !ok {
+				r = 0xfffd
+			}
+			v = constant.MakeString(string(rune(r)))
+		}
+		if v.Kind() != constant.String {
+			return unknownConst
+		}
+	case "bool":
+		if v.Kind() != constant.Bool {
+			return unknownConst
+		}
+	default:
+		return unknownConst
+	}
+	return constValue{v, typ}
+}
+
+var litKinds = map[token.Token]gotoken.Token{
+	token.INT:    gotoken.INT,
+	token.FLOAT:  gotoken.FLOAT,
+	token.IMAG:   gotoken.IMAG,
+	token.CHAR:   gotoken.CHAR,
+	token.STRING: gotoken.STRING,
+}
+
+// constOps maps from the operators in constant
+// expressions to their go/token equivalents.
+var constOps = map[token.Token]gotoken.Token{
+	token.ADD:     gotoken.ADD,
+	token.SUB:     gotoken.SUB,
+	token.MUL:     gotoken.MUL,
+	token.QUO:     gotoken.QUO,
+	token.REM:     gotoken.REM,
+	token.AND:     gotoken.AND,
+	token.OR:      gotoken.OR,
+	token.XOR:     gotoken.XOR,
+	token.SHL:     gotoken.SHL,
+	token.SHR:     gotoken.SHR,
+	token.AND_NOT: gotoken.AND_NOT,
+	token.LAND:    gotoken.LAND,
+	token.LOR:     gotoken.LOR,
+	token.EQL:     gotoken.EQL,
+	token.NEQ:     gotoken.NEQ,
+	token.LSS:     gotoken.LSS,
+	token.LEQ:     gotoken.LEQ,
+	token.GTR:     gotoken.GTR,
+	token.GEQ:     gotoken.GEQ,
+	token.NOT:     gotoken.NOT,
+}
+
+// unsignedBits holds the size of each unsigned type, which
+// determines the result of the ^ operator. Other types
+// have unlimited precision for the purposes of ^.
+var unsignedBits = map[string]uint{
+	"uint":    64,
+	"uint8":   8,
+	"uint16":  16,
+	"uint32":  32,
+	"uint64":  64,
+	"uintptr": 64,
+}
@@ -0,0 +1,100 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/rogpeppe/godef/go/ast"
+	"github.com/rogpeppe/godef/go/parser"
+)
+
+const constSrc = `package p
+
+type Weekday int
+
+type Duration int64
+
+const Second Duration = 1e3
+
+const (
+	Sunday Weekday = iota
+	Monday
+	Tuesday
+)
+
+const (
+	_  = iota
+	KB = 1 << (10 * iota)
+	MB
+)
+
+const (
+	a, b = iota, iota * 10
+	c, d
+)
+
+const (
+	Greeting = "hello, " + "world"
+	Length   = len(Greeting)
+	Half     = 1 / 2
+	FHalf    = 1.0 / 2
+	Typed    = float64(1) / 4
+	Mask     = ^uint8(1)
+	Neg      = -5 % 3
+	Less     = KB < MB
+	Char     = 'a' + 1
+	Str      = string(Char)
+	Timeout  = 2 * Second
+	Big      = 1 << 100 >> 98
+	Unknown  = undefined + 1
+)
+`
+
+var constTests = []struct {
+	name string
+	want string
+}{
+	{"Sunday", "0"},
+	{"Monday", "1"},
+	{"Tuesday", "2"},
+	{"KB", "1024"},
+	{"MB", "1048576"},
+	{"a", "0"},
+	{"b", "0"},
+	{"c", "1"},
+	{"d", "10"},
+	{"Greeting", `"hello, world"`},
+	{"Length", "12"},
+	{"Half", "0"},
+	{"FHalf", "0.5"},
+	{"Typed", "0.25"},
+	{"Mask", "254"},
+	{"Neg", "-2"},
+	{"Less", "true"},
+	{"Char", "98"},
+	{"Str", `"b"`},
+	{"Timeout", "2000"},
+	{"Big", "4"},
+	{"Unknown", ""},
+}
+
+func TestConstValue(t *testing.T) {
+	pkgScope := ast.NewScope(parser.Universe)
+	_, err := parser.ParseFile(FileSet, "const.go", constSrc, 0, pkgScope, DefaultImportPathToName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range constTests {
+		obj := pkgScope.Lookup(test.name)
+		if obj == nil {
+			t.Errorf("%s not found", test.name)
+			continue
+		}
+		got := ""
+		if v := ConstValue(obj, DefaultImporter, FileSet); v != nil {
+			got = v.String()
+		}
+		if got != test.want {
+			t.Errorf("%s: got %q; want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package types
+
+import (
+	"go/build"
+	"go/constant"
+	"sync"
+
+	"github.com/rogpeppe/godef/go/ast"
+	"github.com/rogpeppe/godef/go/token"
+)
+
+// Context holds the state used to infer types: the file set,
+// the packages imported so far and the options. Unlike the package
+// level ExprType and DefaultImporter functions, it does not use any
+// global variables, and each package is parsed only once, so it can be
+// shared by many queries. It is safe to call its methods concurrently.
+//
+// A Context must be created with NewContext, and its fields
+// must not be changed once it is in use.
+type Context struct {
+	// FileSet holds the positions of the files
+	// parsed by the context.
+	FileSet *token.FileSet
+
+	// Build is used to find imported packages.
+	Build *build.Context
+
+	// When Debug is true, log messages will be printed.
+	Debug bool
+
+	// When Panic is false, panics when looking up
+	// members are logged rather than propagated.
+	Panic bool
+
+	mu sync.Mutex
+
+	// pkgs holds the imported packages, keyed
+	// by the directory that holds them.
+	pkgs map[string]*importedPackage
+}
+
+// importedPackage holds a package that is being, or has been, parsed.
+type importedPackage struct {
+	// ready is closed when pkg has been set.
+	ready chan struct{}
+	pkg   *ast.Package
+}
+
+// NewContext returns a new Context with a new FileSet,
+// which finds packages with build.Default.
+func NewContext() *Context {
+	return &Context{
+		FileSet: token.NewFileSet(),
+		Build:   &build.Default,
+		Panic:   true,
+		pkgs:    make(map[string]*importedPackage),
+	}
+}
+
+// Import returns the package with the given import path, as
+// found from the directory srcDir. Packages are parsed the first
+// time they are imported, and their files added to ctxt.FileSet.
+// Import returns nil if the package cannot be found or parsed.
+func (ctxt *Context) Import(path, srcDir string) *ast.Package {
+	bpkg, err := ctxt.Build.Import(path, srcDir, 0)
+	if err != nil {
+		return nil
+	}
+	ctxt.mu.Lock()
+	p := ctxt.pkgs[bpkg.Dir]
+	if p != nil {
+		ctxt.mu.Unlock()
+		<-p.ready
+		return p.pkg
+	}
+	p = &importedPackage{
+		ready: make(chan struct{}),
+	}
+	ctxt.pkgs[bpkg.Dir] = p
+	ctxt.mu.Unlock()
+
+	p.pkg = parsePackage(ctxt.FileSet, bpkg, ctxt.ImportPathToName, ctxt.Debug)
+	close(p.ready)
+	return p.pkg
+}
+
+// ImportPathToName is like DefaultImportPathToName, but finds
+// packages with ctxt.Build. It can be used to parse files
+// for use with the context.
+func (ctxt *Context) ImportPathToName(path, srcDir string) (string, error) {
+	if path == "C" {
+		return "C", nil
+	}
+	pkg, err := ctxt.Build.Import(path, srcDir, 0)
+	return pkg.Name, err
+}
+
+// ExprType is like the ExprType function, but
+// imports packages with ctxt.Import.
+func (ctxt *Context) ExprType(e ast.Expr) (obj *ast.Object, typ Type) {
+	return ctxt.exprTypeContext().exprType(e, false, "")
+}
+
+// KeyField is like the KeyField function, but
+// imports packages with ctxt.Import.
+func (ctxt *Context) KeyField(lits []*ast.CompositeLit, key *ast.Ident) (obj *ast.Object, typ Type) {
+	return ctxt.exprTypeContext().keyField(lits, key)
+}
+
+// ConstValue is like the ConstValue function, but
+// imports packages with ctxt.Import.
+func (ctxt *Context) ConstValue(obj *ast.Object) constant.Value {
+	return constValueOf(ctxt.exprTypeContext(), obj)
+}
+
+func (ctxt *Context) exprTypeContext() *exprTypeContext {
+	return &exprTypeContext{
+		importer: ctxt.Import,
+		fileSet:  ctxt.FileSet,
+		debug:    ctxt.Debug,
+		panic:    ctxt.Panic,
+	}
+}
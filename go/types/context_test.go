@@ -0,0 +1,82 @@
+package types
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/rogpeppe/godef/go/ast"
+	"github.com/rogpeppe/godef/go/parser"
+	"github.com/rogpeppe/godef/internal/testfiles"
+)
+
+var contextFiles = map[string]string{
+	"a/a.go": `package a
+
+type T struct {
+	Name string
+}
+
+const N = 1 << 4
+`,
+	"b/b.go": `package b
+
+import "../a"
+
+func F() a.T {
+	return a.T{}
+}
+`,
+}
+
+const contextSrc = `package m
+
+import (
+	"./a"
+	"./b"
+)
+
+var x = b.F().Name
+var y = a.N
+`
+
+func TestContext(t *testing.T) {
+	dir := testfiles.Write(t, contextFiles)
+	defer os.RemoveAll(dir)
+	ctxt := NewContext()
+	filename := filepath.Join(dir, "m.go")
+	const n = 8
+	objs := make([][2]*ast.Object, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			f, err := parser.ParseFile(ctxt.FileSet, filename, contextSrc, 0, ast.NewScope(parser.Universe), ctxt.ImportPathToName)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			for j, spec := range f.Decls[1:] {
+				e := spec.(*ast.GenDecl).Specs[0].(*ast.ValueSpec).Values[0]
+				objs[i][j], _ = ctxt.ExprType(e)
+			}
+		}(i)
+	}
+	wg.Wait()
+	for i, o := range objs {
+		if o[0] == nil || o[0].Name != "Name" || o[1] == nil || o[1].Name != "N" {
+			t.Fatalf("goroutine %d: unexpected objects %v", i, o)
+		}
+		if o != objs[0] {
+			t.Errorf("goroutine %d: objects not shared; got %p want %p", i, o, objs[0])
+		}
+	}
+	if v := ctxt.ConstValue(objs[0][1]); v == nil || v.String() != "16" {
+		t.Errorf("unexpected value of N: %v", v)
+	}
+	if ctxt.Import("./a", dir) != ctxt.Import("../a", filepath.Join(dir, "b")) {
+		t.Errorf("package imported twice")
+	}
+}
@@ -0,0 +1,93 @@
+package types
+
+import (
+	"github.com/rogpeppe/godef/go/ast"
+	"github.com/rogpeppe/godef/go/token"
+)
+
+// KeyField returns the struct field named by key, the key of an
+// element of a composite literal, and the type of the field.
+// Lits holds the composite literals enclosing key, outermost
+// first, so that the types of literals with elided types can
+// be found; key must be a key in the last of them.
+//
+// The keys of map, slice and array literals are not field
+// names, so for those KeyField returns ExprType(key, importer, fs).
+// KeyField returns a nil object if the type of the literal
+// cannot be determined.
+func KeyField(lits []*ast.CompositeLit, key *ast.Ident, importer Importer, fs *token.FileSet) (obj *ast.Object, typ Type) {
+	ctxt := &exprTypeContext{
+		importer: importer,
+		fileSet:  fs,
+		debug:    Debug,
+		panic:    Panic,
+	}
+	return ctxt.keyField(lits, key)
+}
+
+func (ctxt *exprTypeContext) keyField(lits []*ast.CompositeLit, key *ast.Ident) (*ast.Object, Type) {
+	t := ctxt.litType(lits, "")
+	if t.Kind == ast.Bad {
+		return nil, badType
+	}
+	u := t.Underlying(true)
+	if _, ok := u.Node.(*ast.StructType); !ok {
+		return ctxt.exprType(key, false, "")
+	}
+	obj := t.Member(key.Name)
+	if obj == nil || obj.Kind != ast.Var {
+		return nil, badType
+	}
+	_, typ := splitDecl(obj, nil)
+	return obj, ctxt.certify(typ, ast.Var, u.Pkg)
+}
+
+// litType returns the type of the last of lits, a list of
+// nested composite literals, outermost first. The type of
+// a literal with an elided type is taken from the literal
+// that encloses it.
+func (ctxt *exprTypeContext) litType(lits []*ast.CompositeLit, pkg string) Type {
+	n := len(lits) - 1
+	if n < 0 {
+		return badType
+	}
+	if lits[n].Type != nil {
+		return ctxt.certify(lits[n].Type, ast.Var, pkg)
+	}
+	if n == 0 {
+		return badType
+	}
+	outer := ctxt.litType(lits[:n], pkg)
+	if outer.Kind == ast.Bad {
+		return badType
+	}
+	u := outer.Underlying(true)
+	var elem ast.Expr
+	switch t := u.Node.(type) {
+	case *ast.ArrayType:
+		elem = t.Elt
+	case *ast.MapType:
+		elem = t.Value
+		if isLitKey(lits[n-1], lits[n]) {
+			elem = t.Key
+		}
+	default:
+		return badType
+	}
+	// The &T of an element of type *T may also be elided.
+	if star, ok := elem.(*ast.StarExpr); ok {
+		elem = star.X
+	}
+	return ctxt.certify(elem, ast.Var, u.Pkg)
+}
+
+// isLitKey reports whether x is the key
+// of an element of the composite literal lit.
+func isLitKey(lit *ast.CompositeLit, x ast.Expr) bool {
+	for _, e := range lit.Elts {
+		if kv, ok := e.(*ast.KeyValueExpr); ok && kv.Key == x {
+			return true
+		}
+	}
+	return false
+}
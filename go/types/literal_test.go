@@ -0,0 +1,93 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/rogpeppe/godef/go/ast"
+	"github.com/rogpeppe/godef/go/parser"
+)
+
+const keyFieldSrc = `package p
+
+type T struct {
+	Name string
+	Sub  *T
+}
+
+type M map[string]T
+
+var Name = "x"
+
+var (
+	a = T{Name: "a"}
+	b = []T{{Name: "b"}}
+	c = []*T{{Sub: nil}}
+	d = map[T]int{{Name: "d"}: 1}
+	e = M{Name: {Name: "e"}}
+	f = [...][]T{{{Name: "f"}}}
+	g = &T{Sub: &T{Name: "g"}}
+)
+`
+
+// keyFieldTests maps the name of each variable to the
+// declaration line of what the keys in its value refer to.
+var keyFieldTests = map[string][]int{
+	"a": {4},
+	"b": {4},
+	"c": {5},
+	"d": {4},
+	"e": {10, 4},
+	"f": {4},
+	"g": {5, 4},
+}
+
+func TestKeyField(t *testing.T) {
+	f, err := parser.ParseFile(FileSet, "keyfield.go", keyFieldSrc, 0, ast.NewScope(parser.Universe), DefaultImportPathToName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, spec := range f.Decls[len(f.Decls)-1].(*ast.GenDecl).Specs {
+		spec := spec.(*ast.ValueSpec)
+		name := spec.Names[0].Name
+		var lits []*ast.CompositeLit
+		var got []int
+		var visit func(n ast.Node) bool
+		visit = func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.CompositeLit:
+				lits = append(lits, n)
+				for _, e := range n.Elts {
+					ast.Inspect(e, visit)
+				}
+				lits = lits[:len(lits)-1]
+				return false
+			case *ast.KeyValueExpr:
+				if id, ok := n.Key.(*ast.Ident); ok {
+					obj, _ := KeyField(lits, id, DefaultImporter, FileSet)
+					if obj == nil {
+						t.Errorf("%s: no object for key %s", name, id.Name)
+						return false
+					}
+					got = append(got, FileSet.Position(DeclPos(obj)).Line)
+				}
+			}
+			return true
+		}
+		ast.Inspect(spec.Values[0], visit)
+		if want := keyFieldTests[name]; !equalInts(got, want) {
+			t.Errorf("%s: got declaration lines %v; want %v", name, got, want)
+		}
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
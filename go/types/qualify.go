@@ -0,0 +1,132 @@
+package types
+
+import (
+	"github.com/rogpeppe/godef/go/ast"
+	"github.com/rogpeppe/godef/go/parser"
+)
+
+// Qualifier returns the name that qualifies identifiers declared
+// in the package with the given import path, or the empty string
+// if they should be left unqualified.
+type Qualifier func(path string) string
+
+// Qualified returns the type's parse tree with the names of types
+// and constants declared in other packages qualified by qual.
+// Parts of the tree that need no change are shared with t.Node.
+func (t Type) Qualified(qual Qualifier) ast.Node {
+	q := &qualifier{pkg: t.Pkg, qual: qual}
+	switch n := t.Node.(type) {
+	case ast.Expr:
+		return q.expr(n)
+	case MultiValue:
+		types := make([]ast.Expr, len(n.Types))
+		for i, e := range n.Types {
+			types[i] = q.expr(e)
+		}
+		return MultiValue{types}
+	}
+	return t.Node
+}
+
+type qualifier struct {
+	// pkg holds the path of the package that
+	// the identifiers are relative to.
+	pkg  string
+	qual Qualifier
+}
+
+func (q *qualifier) expr(e ast.Expr) ast.Expr {
+	switch e := e.(type) {
+	case *ast.Ident:
+		obj := e.Obj
+		if q.pkg == "" || obj == nil || obj.Kind != ast.Typ && obj.Kind != ast.Con || parser.Universe.Lookup(e.Name) == obj {
+			return e
+		}
+		return q.selector(q.pkg, e)
+	case *ast.SelectorExpr:
+		x, ok := e.X.(*ast.Ident)
+		if !ok || x.Obj == nil || x.Obj.Kind != ast.Pkg {
+			return e
+		}
+		spec, ok := x.Obj.Decl.(*ast.ImportSpec)
+		if !ok {
+			return e
+		}
+		return q.selector(litToString(spec.Path), e.Sel)
+	case *ast.ParenExpr:
+		return &ast.ParenExpr{e.Lparen, q.expr(e.X), e.Rparen}
+	case *ast.StarExpr:
+		return &ast.StarExpr{e.Star, q.expr(e.X)}
+	case *ast.Ellipsis:
+		if e.Elt == nil {
+			return e
+		}
+		return &ast.Ellipsis{e.Ellipsis, q.expr(e.Elt)}
+	case *ast.ArrayType:
+		n := *e
+		if n.Len != nil {
+			n.Len = q.expr(n.Len)
+		}
+		n.Elt = q.expr(n.Elt)
+		return &n
+	case *ast.MapType:
+		return &ast.MapType{e.Map, q.expr(e.Key), q.expr(e.Value)}
+	case *ast.ChanType:
+		return &ast.ChanType{e.Begin, e.Dir, q.expr(e.Value)}
+	case *ast.FuncType:
+		return &ast.FuncType{e.Func, q.fields(e.Params), q.fields(e.Results)}
+	case *ast.StructType:
+		return &ast.StructType{e.Struct, q.fields(e.Fields), e.Incomplete}
+	case *ast.InterfaceType:
+		return &ast.InterfaceType{e.Interface, q.fields(e.Methods), e.Incomplete}
+	}
+	return e
+}
+
+func (q *qualifier) fields(fields *ast.FieldList) *ast.FieldList {
+	if fields == nil {
+		return nil
+	}
+	list := make([]*ast.Field, len(fields.List))
+	for i, f := range fields.List {
+		nf := *f
+		nf.Type = q.expr(anonFieldType(f))
+		list[i] = &nf
+	}
+	return &ast.FieldList{fields.Opening, list, fields.Closing}
+}
+
+// anonFieldType returns the type of the field f. The parser gives
+// the identifier in an anonymous field its own object, so we use the
+// type from that object's declaration, which refers to the original
+// type.
+func anonFieldType(f *ast.Field) ast.Expr {
+	if f.Names != nil {
+		return f.Type
+	}
+	t := f.Type
+	if st, ok := t.(*ast.StarExpr); ok {
+		t = st.X
+	}
+	if sel, ok := t.(*ast.SelectorExpr); ok {
+		t = sel.Sel
+	}
+	id, ok := t.(*ast.Ident)
+	if !ok || id.Obj == nil {
+		return f.Type
+	}
+	if decl, ok := id.Obj.Decl.(*ast.Field); ok && decl.Type != nil {
+		return decl.Type
+	}
+	return f.Type
+}
+
+// selector returns id qualified by the name of the
+// package with the given path.
+func (q *qualifier) selector(path string, id *ast.Ident) ast.Expr {
+	name := q.qual(path)
+	if name == "" {
+		return id
+	}
+	return &ast.SelectorExpr{&ast.Ident{NamePos: id.NamePos, Name: name}, id}
+}
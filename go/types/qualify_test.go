@@ -0,0 +1,102 @@
+package types
+
+import (
+	"bytes"
+	"path"
+	"testing"
+
+	"github.com/rogpeppe/godef/go/ast"
+	"github.com/rogpeppe/godef/go/parser"
+	"github.com/rogpeppe/godef/go/printer"
+)
+
+var qualifySrc = map[string]string{
+	"example.com/q": `package q
+
+import rr "example.com/r"
+
+const N = 2
+
+type U int
+
+type T struct {
+	A rr.X
+	B *U
+	U
+	*rr.Y
+	C func([]int, ...U) map[rr.X]chan U
+	D [N]string
+}
+`,
+	"example.com/r": `package r
+
+type X int
+
+type Y int
+`,
+}
+
+const qualifyUser = `package p
+
+import (
+	"example.com/q"
+	"example.com/r"
+)
+
+var v q.T
+var _ r.X
+`
+
+func TestQualified(t *testing.T) {
+	importPathToName := func(p, srcDir string) (string, error) {
+		return path.Base(p), nil
+	}
+	importer := func(p, srcDir string) *ast.Package {
+		src, ok := qualifySrc[p]
+		if !ok {
+			return nil
+		}
+		scope := ast.NewScope(parser.Universe)
+		f, err := parser.ParseFile(FileSet, p+"/x.go", src, 0, scope, importPathToName)
+		if err != nil {
+			t.Fatalf("cannot parse %s: %v", p, err)
+		}
+		return &ast.Package{f.Name.Name, scope, nil, map[string]*ast.File{p + "/x.go": f}}
+	}
+	f, err := parser.ParseFile(FileSet, "p.go", qualifyUser, 0, ast.NewScope(parser.Universe), importPathToName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	typ := f.Decls[1].(*ast.GenDecl).Specs[0].(*ast.ValueSpec).Type
+	_, tt := ExprType(typ, importer, FileSet)
+	if tt.Kind != ast.Typ {
+		t.Fatalf("cannot find type of %v", pretty{typ})
+	}
+	tt = tt.Underlying(false)
+	node := tt.Qualified(func(p string) string {
+		if p == "example.com/r" {
+			return "renamed"
+		}
+		return path.Base(p)
+	})
+	var buf bytes.Buffer
+	printer.Fprint(&buf, FileSet, node)
+	want := `struct {
+	A	renamed.X
+	B	*q.U
+	q.U
+	*renamed.Y
+	C	func([]int, ...q.U) map[renamed.X]chan q.U
+	D	[q.N]string
+}`
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	// The original node is unchanged.
+	buf.Reset()
+	printer.Fprint(&buf, FileSet, tt.Node)
+	if got := buf.String(); !bytes.Contains(buf.Bytes(), []byte("A\trr.X")) {
+		t.Errorf("original node changed; got\n%s", got)
+	}
+}
@@ -4,13 +4,12 @@ package types
 
 import (
 	"bytes"
-	"container/list"
+	"context"
 	"fmt"
 	"go/build"
 	"log"
 	"os"
 	"path/filepath"
-	"runtime"
 	"strconv"
 	"strings"
 
@@ -56,8 +55,6 @@ func (MultiValue) End() token.Pos {
 
 var badType = Type{Kind: ast.Bad}
 
-var makeIdent = predecl("make")
-var newIdent = predecl("new")
 var falseIdent = predecl("false")
 var trueIdent = predecl("true")
 var iotaIdent = predecl("iota")
@@ -77,11 +74,19 @@ var FileSet = token.NewFileSet()
 
 // DefaultImporter looks for the package; if it finds it,
 // it parses and returns it. If no package was found, it returns nil.
+// The package is parsed again on every call; use a Context to
+// share parsed packages.
 func DefaultImporter(path string, srcDir string) *ast.Package {
 	bpkg, err := build.Default.Import(path, srcDir, 0)
 	if err != nil {
 		return nil
 	}
+	return parsePackage(FileSet, bpkg, DefaultImportPathToName, Debug)
+}
+
+// parsePackage parses the files in bpkg, adding them to fset.
+// If debug is true, errors are logged.
+func parsePackage(fset *token.FileSet, bpkg *build.Package, pathToName parser.ImportPathToName, debug bool) *ast.Package {
 	goFiles := make(map[string]bool)
 	for _, f := range bpkg.GoFiles {
 		goFiles[f] = true
@@ -92,16 +97,16 @@ func DefaultImporter(path string, srcDir string) *ast.Package {
 	shouldInclude := func(d os.FileInfo) bool {
 		return goFiles[d.Name()]
 	}
-	pkgs, err := parser.ParseDir(FileSet, bpkg.Dir, shouldInclude, 0, DefaultImportPathToName)
+	pkgs, err := parser.ParseDir(fset, bpkg.Dir, shouldInclude, 0, pathToName)
 	if err != nil {
-		if Debug {
+		if debug {
 			switch err := err.(type) {
 			case scanner.ErrorList:
 				for _, e := range err {
-					debugp("\t%v: %s", e.Pos, e.Msg)
+					log.Printf("\t%v: %s", e.Pos, e.Msg)
 				}
 			default:
-				debugp("\terror parsing %s: %v", bpkg.Dir, err)
+				log.Printf("\terror parsing %s: %v", bpkg.Dir, err)
 			}
 		}
 		return nil
@@ -109,8 +114,8 @@ func DefaultImporter(path string, srcDir string) *ast.Package {
 	if pkg := pkgs[bpkg.Name]; pkg != nil {
 		return pkg
 	}
-	if Debug {
-		debugp("package not found by ParseDir!")
+	if debug {
+		log.Printf("package not found by ParseDir!")
 	}
 	return nil
 }
@@ -147,51 +152,73 @@ func (t Type) String() string {
 
 var Panic = true
 
+// MemberInfo describes a member of a type found by Members.
+type MemberInfo struct {
+	// Obj holds the object for the member.
+	Obj *ast.Object
+
+	// Depth holds the embedding depth of the member: zero for
+	// members declared by the type itself, one for members
+	// promoted from its anonymous fields, and so on.
+	Depth int
+
+	// Embedded holds the anonymous fields that the member
+	// is promoted through, outermost first. It is empty
+	// when Depth is zero.
+	Embedded []*ast.Object
+}
+
 // Member looks for a member with the given name inside
 // the type. For packages, the member can be any exported
 // top level declaration inside the package.
-func (t Type) Member(name string) *ast.Object {
-	debugp("member %v '%s' {", t, name)
+func (t Type) Member(name string) (m *ast.Object) {
+	t.ctxt.debugp("member %v '%s' {", t, name)
 	if t.Pkg != "" && !ast.IsExported(name) {
 		return nil
 	}
-	c := make(chan *ast.Object)
-	go func() {
-		if !Panic {
-			defer func() {
-				if err := recover(); err != nil {
-					log.Printf("panic: %v", err)
-					c <- nil
-				}
-			}()
-		}
-		doMembers(t, name, func(obj *ast.Object) {
-			if obj.Name == name {
-				c <- obj
-				runtime.Goexit()
+	if t.ctxt != nil && !t.ctxt.panic {
+		defer func() {
+			if err := recover(); err != nil {
+				log.Printf("panic: %v", err)
+				m = nil
 			}
-		})
-		c <- nil
-	}()
-	m := <-c
-	debugp("} -> %v", m)
+		}()
+	}
+	t.members(context.Background(), name, -1, func(info MemberInfo) bool {
+		m = info.Obj
+		return false
+	})
+	t.ctxt.debugp("} -> %v", m)
 	return m
 }
 
+// Members calls fn for each member of the type, shallowest
+// first, until fn returns false. For packages, the members are
+// the exported top level declarations inside the package.
+// Members hidden by a member with the same name at the same or
+// a shallower depth are omitted, as are unexported members
+// of types from other packages. If maxDepth is non-negative,
+// members promoted from deeper than maxDepth are omitted.
+//
+// Members returns ctx.Err() if ctx is done before all
+// the members have been found.
+func (t Type) Members(ctx context.Context, maxDepth int, fn func(MemberInfo) bool) error {
+	return t.members(ctx, "", maxDepth, fn)
+}
+
 // Iter returns a channel, sends on it
 // all the members of the type, then closes it.
 // Members at a shallower depth will be
 // sent first.
 //
+// Deprecated: the goroutine sending the members leaks
+// if they are not all received. Use Members instead.
 func (t Type) Iter() <-chan *ast.Object {
-	// TODO avoid sending members with the same name twice.
 	c := make(chan *ast.Object)
 	go func() {
-		internal := t.Pkg == ""
-		doMembers(t, "", func(obj *ast.Object) {
-			if internal || ast.IsExported(obj.Name) {
-				c <- obj
-			}
+		t.Members(context.Background(), -1, func(m MemberInfo) bool {
+			c <- m.Obj
+			return true
 		})
 		close(c)
 	}()
@@ -209,6 +236,8 @@ func ExprType(e ast.Expr, importer Importer, fs *token.FileSet) (obj *ast.Object
 	ctxt := &exprTypeContext{
 		importer: importer,
 		fileSet:  fs,
+		debug:    Debug,
+		panic:    Panic,
 	}
 	return ctxt.exprType(e, false, "")
 }
@@ -216,12 +245,17 @@ func ExprType(e ast.Expr, importer Importer, fs *token.FileSet) (obj *ast.Object
 type exprTypeContext struct {
 	importer Importer
 	fileSet  *token.FileSet
+
+	// debug and panic hold the values of the
+	// Debug and Panic options.
+	debug bool
+	panic bool
 }
 
 func (ctxt *exprTypeContext) exprType(n ast.Node, expectTuple bool, pkg string) (xobj *ast.Object, typ Type) {
-	debugp("exprType tuple:%v pkg:%s %T %v [", expectTuple, pkg, n, pretty{n})
+	ctxt.debugp("exprType tuple:%v pkg:%s %T %v [", expectTuple, pkg, n, pretty{n})
 	defer func() {
-		debugp("] -> %p, %v", xobj, typ)
+		ctxt.debugp("] -> %p, %v", xobj, typ)
 	}()
 	switch n := n.(type) {
 	case nil:
@@ -251,7 +285,7 @@ func (ctxt *exprTypeContext) exprType(n ast.Node, expectTuple bool, pkg string)
 		case expr != nil:
 			_, t := ctxt.exprType(expr, false, pkg)
 			if t.Kind == ast.Typ {
-				debugp("expected value, got type %v", t)
+				ctxt.debugp("expected value, got type %v", t)
 				t = badType
 			}
 			return obj, t
@@ -283,9 +317,6 @@ func (ctxt *exprTypeContext) exprType(n ast.Node, expectTuple bool, pkg string)
 
 	case *ast.SelectorExpr:
 		_, t := ctxt.exprType(n.X, false, pkg)
-		// TODO: method expressions. when t.Kind == ast.Typ,
-		// 	mutate a method declaration into a function with
-		//	the receiver as first argument
 		if t.Kind == ast.Bad {
 			break
 		}
@@ -303,20 +334,28 @@ func (ctxt *exprTypeContext) exprType(n ast.Node, expectTuple bool, pkg string)
 		// on the class of the receiver expression.
 		if fd, ismethod := obj.Decl.(*ast.FuncDecl); ismethod {
 			if t.Kind == ast.Typ {
-				return obj, ctxt.certify(methodExpr(fd), ast.Fun, t.Pkg)
+				return obj, ctxt.certify(methodExpr(fd.Type, t.Node.(ast.Expr)), ast.Fun, t.Pkg)
 			}
 			return obj, ctxt.certify(fd.Type, ast.Fun, t.Pkg)
 		} else if obj.Kind == ast.Typ {
 			return obj, ctxt.certify(&ast.Ident{Name: obj.Name, Obj: obj}, ast.Typ, t.Pkg)
 		}
 		_, typ := splitDecl(obj, nil)
+		if ft, ok := typ.(*ast.FuncType); ok && t.Kind == ast.Typ && obj.Kind == ast.Fun {
+			// A method expression on an interface type.
+			return obj, ctxt.certify(methodExpr(ft, t.Node.(ast.Expr)), ast.Fun, t.Pkg)
+		}
 		return obj, ctxt.certify(typ, obj.Kind, t.Pkg)
 
 	case *ast.FuncDecl:
-		return nil, ctxt.certify(methodExpr(n), ast.Fun, pkg)
+		return nil, ctxt.certify(n.Type, ast.Fun, pkg)
 
 	case *ast.IndexExpr:
 		_, t0 := ctxt.exprType(n.X, false, pkg)
+		if t0.Kind == ast.Typ || isIterSeq(n.X) {
+			// An instantiated generic type.
+			return nil, ctxt.newType(n, ast.Typ, pkg)
+		}
 		t := t0.Underlying(true)
 		switch n := t.Node.(type) {
 		case *ast.ArrayType:
@@ -329,43 +368,40 @@ func (ctxt *exprTypeContext) exprType(n ast.Node, expectTuple bool, pkg string)
 			return nil, t
 		}
 
+	case *ast.IndexListExpr:
+		if _, t := ctxt.exprType(n.X, false, pkg); t.Kind == ast.Typ || isIterSeq(n.X) {
+			return nil, ctxt.newType(n, ast.Typ, pkg)
+		}
+
 	case *ast.SliceExpr:
 		_, typ := ctxt.exprType(n.X, false, pkg)
 		return nil, typ
 
 	case *ast.CallExpr:
-		switch exprName(n.Fun) {
-		case makeIdent.Obj:
-			if len(n.Args) > 0 {
-				return nil, ctxt.certify(n.Args[0], ast.Var, pkg)
-			}
-		case newIdent.Obj:
-			if len(n.Args) > 0 {
-				t := ctxt.certify(n.Args[0], ast.Var, pkg)
-				if t.Kind != ast.Bad {
-					return nil, ctxt.newType(&ast.StarExpr{n.Pos(), t.Node.(ast.Expr)}, ast.Var, t.Pkg)
-				}
-			}
-		default:
-			if _, fntype := ctxt.exprType(n.Fun, false, pkg); fntype.Kind != ast.Bad {
-				// A type cast transforms a type expression
-				// into a value expression.
-				if fntype.Kind == ast.Typ {
-					fntype.Kind = ast.Var
-					// Preserve constness if underlying expr is constant.
-					if len(n.Args) == 1 {
-						_, argtype := ctxt.exprType(n.Args[0], false, pkg)
-						if argtype.Kind == ast.Con {
-							fntype.Kind = ast.Con
-						}
+		if obj := exprName(n.Fun); obj != nil && parser.Universe.Lookup(obj.Name) == obj && obj.Kind == ast.Fun {
+			return nil, ctxt.builtinCall(obj, n, pkg)
+		}
+		if t, ok := ctxt.unsafeCall(n, pkg); ok {
+			return nil, t
+		}
+		if _, fntype := ctxt.exprType(n.Fun, false, pkg); fntype.Kind != ast.Bad {
+			// A type cast transforms a type expression
+			// into a value expression.
+			if fntype.Kind == ast.Typ {
+				fntype.Kind = ast.Var
+				// Preserve constness if underlying expr is constant.
+				if len(n.Args) == 1 {
+					_, argtype := ctxt.exprType(n.Args[0], false, pkg)
+					if argtype.Kind == ast.Con {
+						fntype.Kind = ast.Con
 					}
-					return nil, fntype
-				}
-				// A function call operates on the underlying type,
-				t := fntype.Underlying(true)
-				if fn, ok := t.Node.(*ast.FuncType); ok {
-					return nil, ctxt.certify(fields2type(fn.Results), ast.Var, t.Pkg)
 				}
+				return nil, fntype
+			}
+			// A function call operates on the underlying type,
+			t := fntype.Underlying(true)
+			if fn, ok := t.Node.(*ast.FuncType); ok {
+				return nil, ctxt.certify(fields2type(fn.Results), ast.Var, t.Pkg)
 			}
 		}
 
@@ -399,23 +435,7 @@ func (ctxt *exprTypeContext) exprType(n ast.Node, expectTuple bool, pkg string)
 					return nil, ctxt.certify(ct.Value, ast.Var, u.Pkg)
 				}
 			case token.RANGE:
-				switch n := u.Node.(type) {
-				case *ast.ArrayType:
-					if expectTuple {
-						return nil, ctxt.newType(MultiValue{[]ast.Expr{predecl("int"), n.Elt}}, ast.Var, u.Pkg)
-					}
-
-					return nil, ctxt.newType(predecl("bool"), ast.Var, "")
-
-				case *ast.MapType:
-					if expectTuple {
-						return nil, ctxt.newType(MultiValue{[]ast.Expr{n.Key, n.Value}}, ast.Var, u.Pkg)
-					}
-					return nil, ctxt.certify(n.Key, ast.Var, u.Pkg)
-
-				case *ast.ChanType:
-					return nil, ctxt.certify(n.Value, ast.Var, u.Pkg)
-				}
+				return nil, ctxt.rangeType(t, expectTuple)
 
 			case token.AND:
 				if t.Kind == ast.Var {
@@ -471,7 +491,7 @@ func (ctxt *exprTypeContext) exprType(n ast.Node, expectTuple bool, pkg string)
 			id = floatIdent
 
 		default:
-			debugp("unknown constant type %v", n.Kind)
+			ctxt.debugp("unknown constant type %v", n.Kind)
 		}
 		if id != nil {
 			return nil, ctxt.newType(id, ast.Con, "")
@@ -504,6 +524,141 @@ func (ctxt *exprTypeContext) exprType(n ast.Node, expectTuple bool, pkg string)
 	return nil, badType
 }
 
+// rangeType returns the type of the iteration variables in a
+// range clause over a value of type t: the type of the first
+// variable, or of both variables if expectTuple is true.
+func (ctxt *exprTypeContext) rangeType(t Type, expectTuple bool) Type {
+	var key, value ast.Expr
+	pkg := t.Pkg
+	if args := iterSeqArgs(t.Node); args != nil {
+		key = args[0]
+		if len(args) > 1 {
+			value = args[1]
+		}
+	} else {
+		u := t.Underlying(true)
+		pkg = u.Pkg
+		switch n := u.Node.(type) {
+		case *ast.ArrayType:
+			key, value = predecl("int"), n.Elt
+
+		case *ast.MapType:
+			key, value = n.Key, n.Value
+
+		case *ast.ChanType:
+			key = n.Value
+
+		case *ast.FuncType:
+			// An iterator function with a yield function
+			// parameter taking the iteration variables.
+			if n.Params == nil || len(n.Params.List) != 1 {
+				break
+			}
+			_, yt := ctxt.exprType(n.Params.List[0].Type, false, u.Pkg)
+			yt = yt.Underlying(true)
+			yield, ok := yt.Node.(*ast.FuncType)
+			if !ok {
+				break
+			}
+			pkg = yt.Pkg
+			switch params := fields2type(yield.Params).(type) {
+			case MultiValue:
+				if len(params.Types) == 2 {
+					key, value = params.Types[0], params.Types[1]
+				}
+			case ast.Expr:
+				key = params
+			}
+
+		default:
+			switch id := basicType(t); {
+			case id == nil:
+			case id.Obj == stringIdent.Obj:
+				key, value = predecl("int"), predecl("rune")
+			case isInteger(id):
+				// The iteration variable has the
+				// type of the range expression.
+				if expectTuple {
+					return badType
+				}
+				return ctxt.newType(t.Node, ast.Var, t.Pkg)
+			}
+		}
+	}
+	switch {
+	case key == nil:
+		return badType
+	case expectTuple && value != nil:
+		return ctxt.newType(MultiValue{[]ast.Expr{key, value}}, ast.Var, pkg)
+	}
+	return ctxt.certify(key, ast.Var, pkg)
+}
+
+// basicType returns the predeclared type underlying t,
+// or nil if there is none. We can't use Underlying(true)
+// because it fails on predeclared types.
+func basicType(t Type) *ast.Ident {
+	for {
+		id, ok := t.Node.(*ast.Ident)
+		if !ok || id.Obj == nil {
+			return nil
+		}
+		if parser.Universe.Lookup(id.Name) == id.Obj {
+			return id
+		}
+		if t = t.Underlying(false); t.Kind == ast.Bad {
+			return nil
+		}
+	}
+}
+
+// isInteger reports whether id is a predeclared integer type.
+func isInteger(id *ast.Ident) bool {
+	switch id.Name {
+	case "int", "int8", "int16", "int32", "int64",
+		"uint", "uint8", "uint16", "uint32", "uint64", "uintptr",
+		"byte", "rune":
+		return parser.Universe.Lookup(id.Name) == id.Obj
+	}
+	return false
+}
+
+// isIterSeq reports whether x names iter.Seq or iter.Seq2.
+// The iter package is generic, so we can't parse it.
+func isIterSeq(x ast.Expr) bool {
+	sel, ok := x.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Seq" && sel.Sel.Name != "Seq2" {
+		return false
+	}
+	return selectorPkg(sel) == "iter"
+}
+
+// iterSeqArgs returns the type arguments of n if it is an
+// instantiation of iter.Seq or iter.Seq2.
+func iterSeqArgs(n ast.Node) []ast.Expr {
+	var x ast.Expr
+	var args []ast.Expr
+	switch n := n.(type) {
+	case *ast.IndexExpr:
+		x, args = n.X, []ast.Expr{n.Index}
+	case *ast.IndexListExpr:
+		x, args = n.X, n.Indices
+	default:
+		return nil
+	}
+	if !isIterSeq(x) {
+		return nil
+	}
+	want := 1
+	if x.(*ast.SelectorExpr).Sel.Name == "Seq2" {
+		want = 2
+	}
+	if len(args) != want {
+		return nil
+	}
+	return args
+}
+
 func (ctxt *exprTypeContext) newType(n ast.Node, kind ast.ObjKind, pkg string) Type {
 	return Type{
 		Node: n,
@@ -525,102 +680,186 @@ func litToString(lit *ast.BasicLit) (v string) {
 	return v
 }
 
-// doMembers iterates through a type's members, calling
-// fn for each member. If name is non-empty, it looks
-// directly for members with that name when possible.
-// It uses the list q as a queue to perform breadth-first
-// traversal, as per the Go specification.
-func doMembers(typ Type, name string, fn func(*ast.Object)) {
-	switch t := typ.Node.(type) {
+// memberSearch holds the state of a breadth-first
+// search for the members of a type, as per the Go
+// specification.
+type memberSearch struct {
+	ctx context.Context
+
+	// name holds the name of the member to look
+	// for, or the empty string to find all members.
+	name string
+
+	// internal reports whether unexported
+	// members should be found.
+	internal bool
+
+	fn   func(MemberInfo) bool
+	done bool
+
+	// seen holds the names of the members found so far,
+	// which hide any deeper members with the same name.
+	seen map[string]bool
+
+	// visited holds the named types that have been searched,
+	// so that recursively embedded types are searched once.
+	visited map[*ast.Object]bool
+
+	// depth and embedded describe the position of
+	// the type being searched.
+	depth    int
+	embedded []*ast.Object
+
+	// next holds the types of the anonymous fields
+	// to search at the next depth.
+	next []embeddedType
+}
+
+// embeddedType holds the type of an anonymous field along
+// with the anonymous fields that lead to it.
+type embeddedType struct {
+	typ      Type
+	embedded []*ast.Object
+}
+
+// members calls fn for each member of t with the given name, or for
+// all members if name is empty. It is the implementation of Members.
+func (t Type) members(ctx context.Context, name string, maxDepth int, fn func(MemberInfo) bool) error {
+	s := &memberSearch{
+		ctx:      ctx,
+		name:     name,
+		internal: t.Pkg == "",
+		fn:       fn,
+		seen:     make(map[string]bool),
+		visited:  make(map[*ast.Object]bool),
+	}
+	switch n := t.Node.(type) {
 	case nil:
-		return
+		return nil
 
 	case *ast.ImportSpec:
-		path := litToString(t.Path)
-		pos := typ.ctxt.fileSet.Position(typ.Node.Pos())
-		if pkg := typ.ctxt.importer(path, filepath.Dir(pos.Filename)); pkg != nil {
-			doScope(pkg.Scope, name, fn, path)
+		path := litToString(n.Path)
+		pos := t.ctxt.fileSet.Position(n.Pos())
+		if pkg := t.ctxt.importer(path, filepath.Dir(pos.Filename)); pkg != nil {
+			s.scope(pkg.Scope, path)
 		}
-		return
+		return nil
 	}
+	level := []embeddedType{{typ: t}}
+	for len(level) > 0 && (maxDepth < 0 || s.depth <= maxDepth) {
+		for _, e := range level {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			s.embedded = e.embedded
+			s.typeMembers(e.typ)
+			if s.done {
+				return nil
+			}
+		}
+		level, s.next = s.next, nil
+		s.depth++
+	}
+	return nil
+}
 
-	q := list.New()
-	q.PushBack(typ)
-	for e := q.Front(); e != nil; e = q.Front() {
-		doTypeMembers(e.Value.(Type), name, fn, q)
-		q.Remove(e)
+// add calls fn for the member obj unless it is hidden.
+func (s *memberSearch) add(obj *ast.Object) {
+	switch {
+	case s.done || obj == nil || s.seen[obj.Name]:
+		return
+	case s.name != "" && obj.Name != s.name:
+		return
+	case !s.internal && !ast.IsExported(obj.Name):
+		return
+	}
+	s.seen[obj.Name] = true
+	if !s.fn(MemberInfo{Obj: obj, Depth: s.depth, Embedded: s.embedded}) {
+		s.done = true
 	}
 }
 
-// doTypeMembers calls fn for each member of the given type,
-// at one level only. Unnamed members are pushed onto the queue.
-func doTypeMembers(t Type, name string, fn func(*ast.Object), q *list.List) {
+// typeMembers finds the members of the given type,
+// at one level only. The types of anonymous fields
+// are added to s.next.
+func (s *memberSearch) typeMembers(t Type) {
 	// strip off single indirection
 	// TODO: eliminate methods disallowed when indirected.
 	if u, ok := t.Node.(*ast.StarExpr); ok {
 		_, t = t.ctxt.exprType(u.X, false, t.Pkg)
 	}
 	if id, _ := t.Node.(*ast.Ident); id != nil && id.Obj != nil {
+		if s.visited[id.Obj] {
+			return
+		}
+		s.visited[id.Obj] = true
 		if scope, ok := id.Obj.Type.(*ast.Scope); ok {
-			doScope(scope, name, fn, t.Pkg)
+			s.scope(scope, t.Pkg)
 		}
 	}
 	u := t.Underlying(true)
 	switch n := u.Node.(type) {
 	case *ast.StructType:
-		t.ctxt.doStructMembers(n.Fields.List, t.Pkg, fn, q)
+		s.structMembers(t.ctxt, n.Fields.List, t.Pkg)
 
 	case *ast.InterfaceType:
-		t.ctxt.doInterfaceMembers(n.Methods.List, t.Pkg, fn)
+		s.interfaceMembers(t.ctxt, n.Methods.List, t.Pkg)
 	}
 }
 
-func (ctxt *exprTypeContext) doInterfaceMembers(fields []*ast.Field, pkg string, fn func(*ast.Object)) {
+func (s *memberSearch) interfaceMembers(ctxt *exprTypeContext, fields []*ast.Field, pkg string) {
 	// Go Spec: An interface may contain an interface type name T in place of a method
 	// specification. The effect is equivalent to enumerating the methods of T explicitly
 	// in the interface.
 
 	for _, f := range fields {
+		if s.done {
+			return
+		}
 		if len(f.Names) > 0 {
 			for _, fname := range f.Names {
-				fn(fname.Obj)
+				s.add(fname.Obj)
 			}
 		} else {
 			_, typ := ctxt.exprType(f.Type, false, pkg)
 			typ = typ.Underlying(true)
 			switch n := typ.Node.(type) {
 			case *ast.InterfaceType:
-				ctxt.doInterfaceMembers(n.Methods.List, typ.Pkg, fn)
+				s.interfaceMembers(ctxt, n.Methods.List, typ.Pkg)
 			default:
-				debugp("unknown anon type in interface: %T\n", n)
+				ctxt.debugp("unknown anon type in interface: %T\n", n)
 			}
 		}
 	}
 }
 
-func (ctxt *exprTypeContext) doStructMembers(fields []*ast.Field, pkg string, fn func(*ast.Object), q *list.List) {
+func (s *memberSearch) structMembers(ctxt *exprTypeContext, fields []*ast.Field, pkg string) {
 	// Go Spec: For a value x of type T or *T where T is not an interface type, x.f
 	// denotes the field or method at the shallowest depth in T where there
 	// is such an f.
-	// Thus we traverse shallower fields first, pushing anonymous fields
-	// onto the queue for later.
+	// Thus we traverse shallower fields first, saving anonymous fields
+	// for the next depth.
 
 	for _, f := range fields {
+		if s.done {
+			return
+		}
 		if len(f.Names) > 0 {
 			for _, fname := range f.Names {
-				fn(fname.Obj)
+				s.add(fname.Obj)
 			}
 		} else {
 			m := unnamedFieldName(f.Type)
-			fn(m.Obj)
+			s.add(m.Obj)
 			// The unnamed field's Decl points to the
 			// original type declaration.
 			_, typeNode := splitDecl(m.Obj, nil)
 			obj, typ := ctxt.exprType(typeNode, false, pkg)
 			if typ.Kind == ast.Typ {
-				q.PushBack(typ)
+				embedded := append(s.embedded[:len(s.embedded):len(s.embedded)], m.Obj)
+				s.next = append(s.next, embeddedType{typ, embedded})
 			} else {
-				debugp("unnamed field kind %v (obj %v) not a type; %v", typ.Kind, obj, typ.Node)
+				ctxt.debugp("unnamed field kind %v (obj %v) not a type; %v", typ.Kind, obj, typ.Node)
 			}
 		}
 	}
@@ -644,23 +883,26 @@ func unnamedFieldName(t ast.Node) *ast.Ident {
 	panic("no name found for unnamed field")
 }
 
-// doScope iterates through all the functions in the given scope, at
+// scope finds the members in the given scope, at
 // the top level only.
-func doScope(s *ast.Scope, name string, fn func(*ast.Object), pkg string) {
-	if s == nil {
+func (s *memberSearch) scope(scope *ast.Scope, pkg string) {
+	if scope == nil {
 		return
 	}
-	if name != "" {
-		if obj := s.Lookup(name); obj != nil {
-			fn(obj)
+	if s.name != "" {
+		if obj := scope.Lookup(s.name); obj != nil {
+			s.add(obj)
 		}
 		return
 	}
-	for _, obj := range s.Objects {
+	for _, obj := range scope.Objects {
+		if s.done {
+			return
+		}
 		if obj.Kind == ast.Bad || pkg != "" && !ast.IsExported(obj.Name) {
 			continue
 		}
-		fn(obj)
+		s.add(obj)
 	}
 }
 
@@ -912,9 +1154,24 @@ func fields2type(fields *ast.FieldList) ast.Node {
 	return MultiValue{elist}
 }
 
-// TODO
-func methodExpr(fd *ast.FuncDecl) *ast.FuncType {
-	return fd.Type
+// methodExpr returns the type of a method expression: the type
+// of the method, ft, with the receiver type recv as the
+// first parameter.
+func methodExpr(ft *ast.FuncType, recv ast.Expr) *ast.FuncType {
+	recvField := &ast.Field{Type: recv}
+	var params []*ast.Field
+	if ft.Params != nil {
+		params = ft.Params.List
+	}
+	if len(params) > 0 && len(params[0].Names) > 0 {
+		// Parameters must be all named or all unnamed.
+		recvField.Names = []*ast.Ident{{NamePos: recv.Pos(), Name: "_"}}
+	}
+	return &ast.FuncType{
+		Func:    ft.Func,
+		Params:  &ast.FieldList{List: append([]*ast.Field{recvField}, params...)},
+		Results: ft.Results,
+	}
 }
 
 // XXX  the following stuff is for debugging - remove later.
@@ -925,6 +1182,12 @@ func debugp(f string, a ...interface{}) {
 	}
 }
 
+func (ctxt *exprTypeContext) debugp(f string, a ...interface{}) {
+	if ctxt != nil && ctxt.debug {
+		log.Printf(f, a...)
+	}
+}
+
 type pretty struct {
 	n interface{}
 }
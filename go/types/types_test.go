@@ -2,7 +2,9 @@ package types
 
 import (
 	"bytes"
+	"context"
 	"flag"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -519,3 +521,276 @@ func xx_varargs@f(xx_args@v ... xx_struct) {
 
 func use(...interface{}) {}
 `)
+
+const membersSrc = `package p
+
+type A struct {
+	X int
+	B
+	*C
+}
+
+func (A) M() {}
+
+type B struct {
+	X string
+	Y int
+	D
+}
+
+func (B) N() {}
+
+type C struct {
+	Y int
+	Z int
+	*A
+}
+
+type D struct {
+	W int
+}
+`
+
+var membersTests = []struct {
+	maxDepth int
+	want     string
+}{{
+	maxDepth: -1,
+	want:     "M0 X0 B0 C0 N1(B) Y1(B) D1(B) Z1(C) A1(C) W2(B.D)",
+}, {
+	maxDepth: 1,
+	want:     "M0 X0 B0 C0 N1(B) Y1(B) D1(B) Z1(C) A1(C)",
+}, {
+	maxDepth: 0,
+	want:     "M0 X0 B0 C0",
+}}
+
+func TestMembers(t *testing.T) {
+	pkgScope := ast.NewScope(parser.Universe)
+	if _, err := parser.ParseFile(FileSet, "members.go", membersSrc, 0, pkgScope, DefaultImportPathToName); err != nil {
+		t.Fatal(err)
+	}
+	_, typ := ExprType(&ast.Ident{Name: "A", Obj: pkgScope.Lookup("A")}, DefaultImporter, FileSet)
+	if typ.Kind != ast.Typ {
+		t.Fatalf("unexpected type %v", typ)
+	}
+	for _, test := range membersTests {
+		var got []string
+		err := typ.Members(context.Background(), test.maxDepth, func(m MemberInfo) bool {
+			s := fmt.Sprintf("%s%d", m.Obj.Name, m.Depth)
+			if len(m.Embedded) > 0 {
+				var via []string
+				for _, e := range m.Embedded {
+					via = append(via, e.Name)
+				}
+				s += "(" + strings.Join(via, ".") + ")"
+			}
+			got = append(got, s)
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g := strings.Join(got, " "); g != test.want {
+			t.Errorf("maxDepth %d; got %s; want %s", test.maxDepth, g, test.want)
+		}
+	}
+
+	n := 0
+	typ.Members(context.Background(), -1, func(m MemberInfo) bool {
+		n++
+		return n < 2
+	})
+	if n != 2 {
+		t.Errorf("members found after stopping; got %d want 2", n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := typ.Members(ctx, -1, func(m MemberInfo) bool {
+		t.Errorf("member %s found after cancellation", m.Obj.Name)
+		return true
+	})
+	if err != context.Canceled {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	if m := typ.Member("W"); m == nil || m.Name != "W" {
+		t.Errorf("Member(W) = %v", m)
+	}
+}
+
+const rangeSrc = `package p
+
+import "iter"
+
+type T struct {
+	F int
+}
+
+type N int
+
+type Iter func(yield func(N, T) bool)
+
+func Seq() iter.Seq[T]              { return nil }
+func Seq2() iter.Seq2[string, *T]   { return nil }
+func Pairs(yield func(int, T) bool) {}
+func Keys(yield func(T) bool)       {}
+
+func f(it Iter, n N, arr [3]T, s string, ch chan T) {
+	for a := range Seq() {
+	}
+	for b, c := range Seq2() {
+	}
+	for d, e := range Pairs {
+	}
+	for g := range Keys {
+	}
+	for h, i := range it {
+	}
+	for j := range n {
+	}
+	for k := range 10 {
+	}
+	for l, m := range s {
+	}
+	for o := range arr {
+	}
+	for q := range ch {
+	}
+}
+`
+
+var rangeTests = map[string]string{
+	"a": "T",
+	"b": "string",
+	"c": "*T",
+	"d": "int",
+	"e": "T",
+	"g": "T",
+	"h": "N",
+	"i": "T",
+	"j": "N",
+	"k": "int",
+	"l": "int",
+	"m": "rune",
+	"o": "int",
+	"q": "T",
+}
+
+func TestRange(t *testing.T) {
+	f, err := parser.ParseFile(FileSet, "range.go", rangeSrc, 0, ast.NewScope(parser.Universe), DefaultImportPathToName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := 0
+	ast.Inspect(f, func(n ast.Node) bool {
+		r, ok := n.(*ast.RangeStmt)
+		if !ok {
+			return true
+		}
+		for _, e := range []ast.Expr{r.Key, r.Value} {
+			id, ok := e.(*ast.Ident)
+			if !ok {
+				continue
+			}
+			found++
+			_, typ := ExprType(id, DefaultImporter, FileSet)
+			got := pretty{typ.Node}.String()
+			if got != rangeTests[id.Name] || typ.Kind != ast.Var {
+				t.Errorf("%s: got %s (%v); want %s", id.Name, got, typ.Kind, rangeTests[id.Name])
+			}
+		}
+		return true
+	})
+	if found != len(rangeTests) {
+		t.Errorf("found %d iteration variables; want %d", found, len(rangeTests))
+	}
+}
+
+const builtinSrc = `package p
+
+import "unsafe"
+
+type T struct {
+	F int
+}
+
+func (t *T) M(x int) string { return "" }
+
+func (t T) V() {}
+
+type I interface {
+	M(x int) string
+}
+
+var (
+	s   []T
+	t   T
+	f32 float32
+	c64 complex64
+)
+
+var (
+	a = append(s, t)[0].F
+	b = min(1, f32, 2)
+	c = max(1, 2)
+	d = len(s)
+	e = cap(s)
+	g = copy(s, s)
+	h = complex(f32, 1)
+	i = complex(1, 2)
+	j = real(c64)
+	k = imag(i)
+	l = recover()
+	m = unsafe.Slice(&t, 1)[0].F
+	n = unsafe.SliceData(s).F
+	o = (*T).M
+	p = T.V
+	q = I.M
+	r = new(T).F
+	u = make([]T, 1)[0]
+)
+`
+
+var builtinTests = map[string]string{
+	"a": "int",
+	"b": "float32",
+	"c": "int",
+	"d": "int",
+	"e": "int",
+	"g": "int",
+	"h": "complex64",
+	"i": "complex128",
+	"j": "float32",
+	"k": "float64",
+	"l": "interface{}",
+	"m": "int",
+	"n": "int",
+	"o": "func(_ *T, x int) string",
+	"p": "func(T)",
+	"q": "func(_ I, x int) string",
+	"r": "int",
+	"u": "T",
+}
+
+func TestBuiltins(t *testing.T) {
+	f, err := parser.ParseFile(FileSet, "builtin.go", builtinSrc, 0, ast.NewScope(parser.Universe), DefaultImportPathToName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := 0
+	for _, spec := range f.Decls[len(f.Decls)-1].(*ast.GenDecl).Specs {
+		spec := spec.(*ast.ValueSpec)
+		name := spec.Names[0].Name
+		found++
+		_, typ := ExprType(spec.Values[0], DefaultImporter, FileSet)
+		got := pretty{typ.Node}.String()
+		if got != builtinTests[name] {
+			t.Errorf("%s: got %s (%v); want %s", name, got, typ.Kind, builtinTests[name])
+		}
+	}
+	if found != len(builtinTests) {
+		t.Errorf("found %d expressions; want %d", found, len(builtinTests))
+	}
+}
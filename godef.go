@@ -11,6 +11,7 @@ import (
 	"io"
 	"io/ioutil"
 	"log"
+	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -36,6 +37,27 @@ var Aflag = flag.Bool("A", false, "print all type and members information")
 var fflag = flag.String("f", "", "Go source filename")
 var acmeFlag = flag.Bool("acme", false, "use current acme window")
 var jsonFlag = flag.Bool("json", false, "output location in JSON format (-t flag is ignored)")
+var qflag = flag.String("q", "", "look up the qualified name importpath.Name[.Member] instead of reading a file")
+var symFlag = flag.String("sym", "", "search the main module for symbols fuzzily matching the given pattern")
+var depsFlag = flag.Bool("deps", false, "with -sym, search the module's dependencies too")
+var outlineFlag = flag.Bool("outline", false, "print the outline of the file in JSON format")
+var highlightFlag = flag.Bool("highlight", false, "print all references in the file to the identifier at the offset")
+var refsFlag = flag.Bool("refs", false, "print all references in the module to the identifier at the offset, classified as declarations, reads, writes or address-taken")
+var stubFlag = flag.String("stub", "", "add stubs to the file for the methods of the interface importpath.Name that the receiver given by -recv lacks")
+var recvFlag = flag.String("recv", "", "with -stub, the receiver of the stubs, such as \"T\" or \"t *T\"")
+var superFlag = flag.Bool("super", false, "list the interface methods implemented by the method at the offset")
+var renameFlag = flag.String("rename", "", "rename the identifier at the offset to the given name everywhere in the module")
+var diffFlag = flag.Bool("diff", false, "with -rename, print a unified diff instead of changing the files")
+var hoverFlag = flag.Bool("hover", false, "print the declaration, package, doc comment and members of the identifier as Markdown (with -json, in the hover field)")
+var layoutFlag = flag.Bool("layout", false, "print the size, alignment and field offsets of struct types (implies -t)")
+var archFlag = flag.String("arch", build.Default.GOARCH, "with -layout, the architecture to compute sizes for")
+var unusedFlag = flag.Bool("unused", false, "report exported identifiers in the main module that are not used outside their package")
+var ctagsFlag = flag.String("ctags", "", "write a ctags file for the main module to the given file")
+var etagsFlag = flag.String("etags", "", "write an Emacs TAGS file for the main module to the given file")
+var httpFlag = flag.String("http", "", "serve the main module's source, cross-referenced, as HTML on the given address")
+var htmlFlag = flag.String("html", "", "write the main module's source, cross-referenced, as static HTML pages in the given directory")
+var fsysFlag = flag.String("9p", "", "serve queries as a 9P file system, posted as the named service in the plan9port name space")
+var incrementalFlag = flag.Bool("incremental", false, "with -ctags or -etags, only reread the files changed since the tags file was written")
 
 var cpuprofile = flag.String("cpuprofile", "", "write CPU profile to this file")
 var memprofile = flag.String("memprofile", "", "write memory profile to this file")
@@ -106,10 +128,106 @@ func run(ctx context.Context) error {
 	}
 
 	types.Debug = *debug
-	*tflag = *tflag || *aflag || *Aflag
+	*tflag = *tflag || *aflag || *Aflag || *layoutFlag
+	if *layoutFlag {
+		// Only go/types knows the sizes of types.
+		if forcePackages == off {
+			return fmt.Errorf("-layout requires the new implementation")
+		}
+		forcePackages = on
+	}
 	searchpos := *offset
 	filename := *fflag
 
+	if *qflag != "" {
+		cfg := &packages.Config{
+			Context: ctx,
+		}
+		fset, gobj, err := godefQuery(cfg, *qflag)
+		if err != nil {
+			return err
+		}
+		// Finding the members can be costly, so
+		// only do it when they will be printed.
+		adapt := adaptGoMember
+		if *aflag || *Aflag || *hoverFlag {
+			adapt = adaptGoObject
+		}
+		obj, err := adapt(fset, gobj)
+		if err != nil {
+			return err
+		}
+		if gobj.Pkg() != nil {
+			obj.Pkg = gobj.Pkg().Path()
+		}
+		// With no file to resolve names relative to, qualify
+		// types that are not in the queried package by
+		// their package names.
+		obj.setQualifier(func(path, name string) string {
+			if gobj.Pkg() != nil && path == gobj.Pkg().Path() {
+				return ""
+			}
+			return name
+		})
+		return print(os.Stdout, obj)
+	}
+
+	if *symFlag != "" {
+		cfg := &packages.Config{
+			Context: ctx,
+		}
+		objs, incomplete, err := searchSymbols(cfg, *symFlag, *depsFlag)
+		if err != nil {
+			return err
+		}
+		for _, err := range incomplete {
+			fmt.Fprintf(os.Stderr, "godef: %v\n", err)
+		}
+		return printSymbols(os.Stdout, objs)
+	}
+
+	if *httpFlag != "" || *htmlFlag != "" {
+		idx, err := buildXref(&packages.Config{Context: ctx}, ".")
+		if err != nil {
+			return err
+		}
+		if *htmlFlag != "" {
+			return idx.writeSite(*htmlFlag)
+		}
+		log.Printf("serving %s on %s", idx.root, *httpFlag)
+		return http.ListenAndServe(*httpFlag, idx)
+	}
+
+	if *fsysFlag != "" {
+		return serveFsys(newGodefFsys(ctx), *fsysFlag)
+	}
+
+	if *unusedFlag {
+		idents, skipped, err := unusedExported(".")
+		if err != nil {
+			return err
+		}
+		for _, err := range skipped {
+			fmt.Fprintf(os.Stderr, "godef: %v\n", err)
+		}
+		return printUnused(os.Stdout, idents)
+	}
+
+	if *ctagsFlag != "" || *etagsFlag != "" {
+		cfg := &packages.Config{
+			Context: ctx,
+		}
+		if *ctagsFlag != "" {
+			if err := writeTags(cfg, *ctagsFlag, ctagsFormat, *incrementalFlag); err != nil {
+				return err
+			}
+		}
+		if *etagsFlag != "" {
+			return writeTags(cfg, *etagsFlag, etagsFormat, *incrementalFlag)
+		}
+		return nil
+	}
+
 	var afile *acmeFile
 	var src []byte
 	if *acmeFlag {
@@ -129,11 +247,56 @@ func run(ctx context.Context) error {
 		}
 		src = b
 	}
+	if *renameFlag != "" {
+		changed, err := rename(filename, src, searchpos, *renameFlag)
+		if err != nil {
+			return err
+		}
+		return writeRename(os.Stdout, changed)
+	}
 	// Load, parse, and type-check the packages named on the command line.
 	cfg := &packages.Config{
 		Context: ctx,
 		Tests:   strings.HasSuffix(filename, "_test.go"),
 	}
+	if *stubFlag != "" {
+		if *recvFlag == "" {
+			return fmt.Errorf("-stub requires -recv")
+		}
+		newSrc, methods, err := stubMethods(cfg, filename, src, *stubFlag, *recvFlag)
+		if err != nil {
+			return err
+		}
+		return writeStubs(os.Stdout, filename, newSrc, methods)
+	}
+	if *outlineFlag {
+		syms, err := outline(cfg, filename, src)
+		if err != nil {
+			return err
+		}
+		return printOutline(os.Stdout, syms)
+	}
+	if *highlightFlag {
+		hs, err := highlights(cfg, filename, src, searchpos)
+		if err != nil {
+			return err
+		}
+		return printReferences(os.Stdout, hs)
+	}
+	if *refsFlag {
+		refs, err := moduleReferences(cfg, filename, src, searchpos)
+		if err != nil {
+			return err
+		}
+		return printReferences(os.Stdout, refs)
+	}
+	if *superFlag {
+		objs, err := superMethods(cfg, filename, src, searchpos)
+		if err != nil {
+			return err
+		}
+		return printSymbols(os.Stdout, objs)
+	}
 	obj, err := adaptGodef(cfg, filename, src, searchpos)
 	if err != nil {
 		return err
@@ -183,9 +346,15 @@ func godef(filename string, src []byte, searchpos int) (*ast.Object, types.Type,
 		}
 		return &ast.Object{Kind: ast.Pkg, Data: pkg.Dir}, types.Type{}, nil
 	case ast.Expr:
+		exprType := func(e ast.Expr) (*ast.Object, types.Type) {
+			if lits := keyLits(f, e); lits != nil {
+				return types.KeyField(lits, e.(*ast.Ident), types.DefaultImporter, types.FileSet)
+			}
+			return types.ExprType(e, types.DefaultImporter, types.FileSet)
+		}
 		if !*tflag {
 			// try local declarations only
-			if obj, typ := types.ExprType(e, types.DefaultImporter, types.FileSet); obj != nil {
+			if obj, typ := exprType(e); obj != nil {
 				return obj, typ, nil
 			}
 		}
@@ -202,10 +371,10 @@ func godef(filename string, src []byte, searchpos int) (*ast.Object, types.Type,
 				return nil, types.Type{}, err
 			}
 		}
-		if obj, typ := types.ExprType(e, types.DefaultImporter, types.FileSet); obj != nil {
+		if obj, typ := exprType(e); obj != nil {
 			return obj, typ, nil
 		}
-		return nil, types.Type{}, fmt.Errorf("no declaration found for %v", pretty{e})
+		return nil, types.Type{}, fmt.Errorf("no declaration found for %v", pretty{e, nil})
 	}
 	return nil, types.Type{}, nil
 }
@@ -218,6 +387,39 @@ func importPath(n *ast.ImportSpec) (string, error) {
 	return p, nil
 }
 
+// keyLits returns the composite literals in f enclosing e,
+// outermost first, if e is the key of an element of the
+// innermost of them, or nil otherwise.
+func keyLits(f *ast.File, e ast.Expr) []*ast.CompositeLit {
+	if _, ok := e.(*ast.Ident); !ok {
+		return nil
+	}
+	var lits, found []*ast.CompositeLit
+	var visit func(n ast.Node) bool
+	visit = func(n ast.Node) bool {
+		if found != nil || n == nil || n.Pos() > e.Pos() || n.End() <= e.Pos() {
+			return false
+		}
+		switch n := n.(type) {
+		case *ast.CompositeLit:
+			lits = append(lits, n)
+			for _, elt := range n.Elts {
+				ast.Inspect(elt, visit)
+			}
+			lits = lits[:len(lits)-1]
+			return false
+		case *ast.KeyValueExpr:
+			if n.Key == e {
+				found = append([]*ast.CompositeLit(nil), lits...)
+				return false
+			}
+		}
+		return true
+	}
+	ast.Inspect(f, visit)
+	return found
+}
+
 type nodeResult struct {
 	node ast.Node
 	err  error
@@ -300,6 +502,12 @@ type Position struct {
 	Column   int    `json:"column,omitempty"`
 }
 
+// Range holds the extent of some source text.
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
 type Kind string
 
 const (
@@ -311,6 +519,8 @@ const (
 	LabelKind  Kind = "label"
 	TypeKind   Kind = "type"
 	PathKind   Kind = "path"
+	FieldKind  Kind = "field"
+	MethodKind Kind = "method"
 )
 
 type Object struct {
@@ -321,6 +531,19 @@ type Object struct {
 	Members  []*Object
 	Type     interface{}
 	Value    interface{}
+
+	// qual determines how types from other
+	// packages are printed.
+	qual qualifier
+}
+
+// setQualifier sets the qualifier used to print the types
+// of obj and its members.
+func (obj *Object) setQualifier(qual qualifier) {
+	obj.qual = qual
+	for _, m := range obj.Members {
+		m.qual = qual
+	}
 }
 
 type orderedObjects []*Object
@@ -334,6 +557,9 @@ func print(out io.Writer, obj *Object) error {
 		fmt.Fprintf(out, "%s\n", obj.Value)
 		return nil
 	}
+	if *hoverFlag {
+		return printHover(out, obj)
+	}
 	if *jsonFlag {
 		jsonStr, err := json.Marshal(obj.Position)
 		if err != nil {
@@ -348,6 +574,11 @@ func print(out io.Writer, obj *Object) error {
 		return nil
 	}
 	fmt.Fprintf(out, "%s\n", typeStr(obj))
+	if *layoutFlag {
+		if err := printLayout(out, obj); err != nil {
+			return err
+		}
+	}
 	if *aflag || *Aflag {
 		for _, obj := range obj.Members {
 			// Ignore unexported members unless Aflag is set.
@@ -377,10 +608,10 @@ func typeStr(obj *Object) string {
 	}
 	fmt.Fprint(buf, obj.Name)
 	if obj.Type != nil {
-		fmt.Fprintf(buf, " %v", pretty{obj.Type})
+		fmt.Fprintf(buf, " %v", pretty{obj.Type, obj.qual})
 	}
 	if obj.Value != nil {
-		fmt.Fprintf(buf, valueFmt, pretty{obj.Value})
+		fmt.Fprintf(buf, valueFmt, pretty{obj.Value, nil})
 	}
 	return buf.String()
 }
@@ -42,6 +42,9 @@ func runGoDefTest(t testing.TB, exporter packagestest.Exporter, runCount int, mo
 
 	const gopathPrefix = "GOPATH="
 	const gorootPrefix = "GOROOT="
+	defer func(gopath, goroot string) {
+		build.Default.GOPATH, build.Default.GOROOT = gopath, goroot
+	}(build.Default.GOPATH, build.Default.GOROOT)
 	for _, v := range exported.Config.Env {
 		if strings.HasPrefix(v, gopathPrefix) {
 			build.Default.GOPATH = v[len(gopathPrefix):]
@@ -69,6 +72,47 @@ func runGoDefTest(t testing.TB, exporter packagestest.Exporter, runCount int, mo
 				t.Errorf("Got %v expected %v", posStr(check), posStr(target))
 			}
 		},
+		"godefQuery": func(query string, target token.Position) {
+			count++
+			fset, gobj, err := godefQuery(exported.Config, query)
+			if err != nil {
+				t.Errorf("query %q: %v", query, err)
+				return
+			}
+			obj, err := adaptGoObject(fset, gobj)
+			if err != nil {
+				t.Errorf("query %q: %v", query, err)
+				return
+			}
+			check := token.Position{
+				Filename: obj.Position.Filename,
+				Line:     obj.Position.Line,
+				Column:   obj.Position.Column,
+			}
+			if posStr(check) != posStr(target) {
+				t.Errorf("query %q: got %v expected %v", query, posStr(check), posStr(target))
+			}
+		},
+		"highlight": func(src token.Position, want string) {
+			count++
+			input, err := ioutil.ReadFile(src.Filename)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			hs, err := highlights(exported.Config, src.Filename, input, src.Offset)
+			if err != nil {
+				t.Errorf("highlight %v: %v", src, err)
+				return
+			}
+			var kinds []string
+			for _, h := range hs {
+				kinds = append(kinds, string(h.Kind))
+			}
+			if got := strings.Join(kinds, ","); got != want {
+				t.Errorf("highlight %v: got %s want %s", posStr(src), got, want)
+			}
+		},
 		"godefPrint": func(src token.Position, mode string, re *regexp.Regexp) {
 			count++
 			obj, err := invokeGodef(exported.Config, src, runCount)
@@ -167,3 +211,61 @@ func localPos(pos token.Position, e *packagestest.Exported, modules []packageste
 	}
 	return pos.String()
 }
+
+func TestOutline(t *testing.T) { packagestest.TestAll(t, testOutline) }
+func testOutline(t *testing.T, exporter packagestest.Exporter) {
+	exported := packagestest.Export(t, exporter, []packagestest.Module{{
+		Name:  "github.com/rogpeppe/godef",
+		Files: packagestest.MustCopyFileTree("testdata"),
+	}})
+	defer exported.Cleanup()
+
+	filename := exported.File("github.com/rogpeppe/godef", "a/random.go")
+	syms, err := outline(exported.Config, filename, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	var walk func(prefix string, syms []*outlineSymbol)
+	walk = func(prefix string, syms []*outlineSymbol) {
+		for _, sym := range syms {
+			got = append(got, fmt.Sprintf("%s%s %s %s %d", prefix, sym.Kind, sym.Name, sym.Detail, sym.SelectionRange.Start.Line))
+			walk(prefix+"\t", sym.Children)
+		}
+	}
+	walk("", syms)
+	want := []string{
+		"func Random func() int 3",
+		"func Random2 func(y int) int 8",
+		"type Pos struct 12",
+		"\tfield x int 13",
+		"\tfield y int 13",
+		"\tmethod Sum func() int 16",
+		"func _ func() 20",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected outline; got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// Unsaved contents are outlined in place of the file on disk,
+	// with types qualified by the names the file imports them as.
+	filename = exported.File("github.com/rogpeppe/godef", "b/b.go")
+	src := []byte(`package b
+
+import aa "github.com/rogpeppe/godef/a"
+
+var P aa.Pos
+`)
+	syms, err = outline(exported.Config, filename, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = nil
+	walk("", syms)
+	want = []string{
+		"var P aa.Pos 5",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected outline; got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// highlights returns all the references in the given file to the
+// object identified at searchpos, in source order. Only the
+// package containing the file is type checked from source.
+func highlights(cfg *packages.Config, filename string, src []byte, searchpos int) ([]reference, error) {
+	isInputFile := newFileCompare(filename)
+	if src != nil {
+		if _, err := os.Stat(filename); err != nil {
+			cfg.Overlay = map[string][]byte{
+				filename: src,
+			}
+		}
+	}
+	var input *ast.File
+	cfg.Mode = packages.LoadSyntax
+	cfg.ParseFile = func(fset *token.FileSet, fname string, filedata []byte) (*ast.File, error) {
+		isInput := isInputFile(fname)
+		if isInput && src != nil {
+			// Using an overlay would cause every dependency to be
+			// type checked from source, so substitute the unsaved
+			// contents here instead when the file exists on disk.
+			filedata = src
+		}
+		file, err := parser.ParseFile(fset, fname, filedata, 0)
+		if file == nil {
+			return nil, err
+		}
+		if isInput {
+			input = file
+		} else {
+			trimAST(file, token.NoPos)
+		}
+		return file, err
+	}
+	lpkgs, err := packages.Load(cfg, "file="+filename)
+	if err != nil {
+		return nil, err
+	}
+	if len(lpkgs) < 1 || input == nil {
+		return nil, fmt.Errorf("no package found containing %s", filename)
+	}
+	fset, info := lpkgs[0].Fset, lpkgs[0].TypesInfo
+	tfile := fset.File(input.Pos())
+	if searchpos < 0 || searchpos > tfile.Size() {
+		return nil, fmt.Errorf("cursor %d is beyond end of file %s (%d)", searchpos, filename, tfile.Size())
+	}
+	m, err := findMatch(input, tfile.Pos(searchpos))
+	if err != nil {
+		return nil, err
+	}
+	if m.ident == nil {
+		return nil, fmt.Errorf("offset %d was not a valid identifier", searchpos)
+	}
+	targets := refTargets(fset, info, input, m.ident)
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no object for %s", m.ident.Name)
+	}
+	return fileReferences(fset, info, input, targets), nil
+}
+
+// goPosition returns the position of p in fset.
+func goPosition(fset *token.FileSet, p token.Pos) Position {
+	pos := fset.Position(p)
+	return Position{
+		Filename: cleanFilename(pos.Filename),
+		Line:     pos.Line,
+		Column:   pos.Column,
+	}
+}
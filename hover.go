@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/doc/comment"
+	"go/parser"
+	"go/token"
+	"io"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// hoverMarkdown returns a Markdown document describing obj, for
+// editors to show when hovering over an identifier. It holds the
+// declaration as printed by typeStr, the path of the package
+// declaring it, its doc comment and, for a type, a summary of
+// its exported fields and methods, one per line.
+func hoverMarkdown(obj *Object) string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "```go\n%s\n```\n", typeStr(obj))
+	if obj.Pkg != "" && obj.Kind != ImportKind {
+		fmt.Fprintf(&buf, "\nPackage `%s`\n", obj.Pkg)
+	}
+	if doc := docComment(obj.Position); doc != "" {
+		// Doc links are shown as plain text, as
+		// there is nowhere offline to link them to.
+		p := comment.Parser{
+			LookupSym: func(recv, name string) bool { return true },
+		}
+		pr := comment.Printer{
+			DocLinkURL: func(*comment.DocLink) string { return "" },
+		}
+		buf.WriteString("\n")
+		buf.Write(pr.Markdown(p.Parse(doc)))
+	}
+	if obj.Kind == TypeKind {
+		var members []string
+		for _, m := range obj.Members {
+			if !ast.IsExported(m.Name) {
+				continue
+			}
+			s := strings.TrimSpace(typeStr(m))
+			if i := strings.Index(s, "\n"); i >= 0 {
+				// Show only the first line of
+				// struct and interface types.
+				s = s[:i] + "…"
+			}
+			members = append(members, "- `"+s+"`\n")
+		}
+		if len(members) > 0 {
+			buf.WriteString("\nMembers:\n\n")
+			buf.WriteString(strings.Join(members, ""))
+		}
+	}
+	return buf.String()
+}
+
+// printHover prints the hover text for obj as Markdown or,
+// if the -json flag is set, as the "hover" field of a JSON
+// object holding the position of obj.
+func printHover(out io.Writer, obj *Object) error {
+	md := hoverMarkdown(obj)
+	if !*jsonFlag {
+		_, err := io.WriteString(out, md)
+		return err
+	}
+	jsonStr, err := json.Marshal(struct {
+		Position
+		Hover string `json:"hover"`
+	}{obj.Position, md})
+	if err != nil {
+		return fmt.Errorf("JSON marshal error: %v", err)
+	}
+	fmt.Fprintf(out, "%s\n", jsonStr)
+	return nil
+}
+
+// docComment returns the text of the doc comment for the
+// declaration of the identifier at pos, or the empty string if
+// there is none. A field or a constant or variable specification
+// without a doc comment may have a line comment instead, and
+// a specification in a group may be documented by the group.
+func docComment(pos Position) string {
+	if pos.Filename == "" || pos.Line <= 0 || pos.Column <= 0 {
+		return ""
+	}
+	fset := token.NewFileSet()
+	f, _ := parser.ParseFile(fset, pos.Filename, nil, parser.ParseComments)
+	if f == nil {
+		return ""
+	}
+	tf := fset.File(f.Pos())
+	if pos.Line > tf.LineCount() {
+		return ""
+	}
+	p := tf.LineStart(pos.Line) + token.Pos(pos.Column-1)
+	if tf.Offset(p) >= tf.Size() {
+		return ""
+	}
+	path, _ := astutil.PathEnclosingInterval(f, p, p)
+	for i, n := range path {
+		var doc *ast.CommentGroup
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			return n.Doc.Text()
+		case *ast.Field:
+			return firstComment(n.Doc, n.Comment).Text()
+		case *ast.TypeSpec:
+			doc = firstComment(n.Doc, n.Comment)
+		case *ast.ValueSpec:
+			doc = firstComment(n.Doc, n.Comment)
+		case ast.Stmt, *ast.FuncLit:
+			return ""
+		default:
+			continue
+		}
+		if gd, ok := path[i+1].(*ast.GenDecl); ok && doc == nil {
+			doc = gd.Doc
+		}
+		return doc.Text()
+	}
+	return ""
+}
+
+// firstComment returns a if it is not nil, and b otherwise.
+func firstComment(a, b *ast.CommentGroup) *ast.CommentGroup {
+	if a != nil {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rogpeppe/godef/internal/testfiles"
+	"golang.org/x/tools/go/packages"
+)
+
+var hoverFiles = map[string]string{
+	"go.mod": "module example.com/m\n",
+	"a/a.go": `package a
+
+// Point is a point in the *plane*.
+//
+// See [Point.Dist].
+type Point struct {
+	X, Y int // coordinates
+	name string
+}
+
+// Dist returns the distance.
+func (p Point) Dist() int { return p.X + p.Y }
+
+// Limits.
+const (
+	// Max is the maximum.
+	Max = 10
+	Min = 1
+)
+
+func use() Point {
+	x := Point{X: Max, Y: Min}
+	return x
+}
+`,
+}
+
+var hoverTests = []struct {
+	at   string
+	want string
+}{{
+	at: "Point{X",
+	want: "```go\ntype Point struct{X int; Y int; name string}\n```\n" +
+		"\nPackage `example.com/m/a`\n" +
+		"\nPoint is a point in the \\*plane\\*.\n\nSee Point.Dist.\n" +
+		"\nMembers:\n\n- `Dist func() int`\n- `X int`\n- `Y int`\n",
+}, {
+	at: "X: Max",
+	want: "```go\nX int\n```\n" +
+		"\nPackage `example.com/m/a`\n" +
+		"\ncoordinates\n",
+}, {
+	at: "Max, Y",
+	want: "```go\nconst Max untyped int = 10\n```\n" +
+		"\nPackage `example.com/m/a`\n" +
+		"\nMax is the maximum.\n",
+}, {
+	at: "Min}",
+	want: "```go\nconst Min untyped int = 1\n```\n" +
+		"\nPackage `example.com/m/a`\n" +
+		"\nLimits.\n",
+}, {
+	at: "x :=",
+	want: "```go\nx Point\n```\n" +
+		"\nPackage `example.com/m/a`\n",
+}}
+
+func TestHover(t *testing.T) {
+	dir := testfiles.Write(t, hoverFiles)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "a", "a.go")
+	src := []byte(hoverFiles["a/a.go"])
+	for _, test := range hoverTests {
+		cfg := &packages.Config{Dir: filepath.Dir(filename)}
+		obj, err := adaptGodef(cfg, filename, src, strings.Index(hoverFiles["a/a.go"], test.at))
+		if err != nil {
+			t.Errorf("%s: %v", test.at, err)
+			continue
+		}
+		if got := hoverMarkdown(obj); got != test.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", test.at, got, test.want)
+		}
+	}
+}
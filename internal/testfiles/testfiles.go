@@ -0,0 +1,32 @@
+// Package testfiles writes files for tests that
+// need them on disk, such as Go modules to load.
+package testfiles
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Write writes files, keyed by slash-separated path, to a new
+// temporary directory and returns its name. The caller should
+// remove the directory when it is done with it.
+func Write(t testing.TB, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "godef-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			os.RemoveAll(dir)
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0666); err != nil {
+			os.RemoveAll(dir)
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	gotypes "go/types"
+	"io"
+	"sort"
+)
+
+// structLayout describes the memory layout of a struct type.
+type structLayout struct {
+	Size   int64
+	Align  int64
+	Fields []fieldLayout
+
+	// Padding holds the total number of bytes of padding.
+	Padding int64
+
+	// SortedSize holds the size that the struct would have
+	// if its fields were ordered by decreasing alignment.
+	SortedSize int64
+}
+
+// fieldLayout describes the position of a field in a struct.
+type fieldLayout struct {
+	Field  *gotypes.Var
+	Offset int64
+	Size   int64
+	Align  int64
+
+	// Padding holds the number of bytes of padding
+	// between the field and the next one, or the end
+	// of the struct.
+	Padding int64
+}
+
+// layoutOf returns the layout of t, which must have a struct
+// underlying type, with the given sizes. It returns nil if t
+// is not a struct.
+func layoutOf(t gotypes.Type, sizes gotypes.Sizes) *structLayout {
+	st, ok := t.Underlying().(*gotypes.Struct)
+	if !ok {
+		return nil
+	}
+	l := &structLayout{
+		Size:  sizes.Sizeof(st),
+		Align: sizes.Alignof(st),
+	}
+	fields := make([]*gotypes.Var, st.NumFields())
+	for i := range fields {
+		fields[i] = st.Field(i)
+	}
+	offsets := sizes.Offsetsof(fields)
+	for i, f := range fields {
+		fl := fieldLayout{
+			Field:  f,
+			Offset: offsets[i],
+			Size:   sizes.Sizeof(f.Type()),
+			Align:  sizes.Alignof(f.Type()),
+		}
+		next := l.Size
+		if i+1 < len(fields) {
+			next = offsets[i+1]
+		}
+		fl.Padding = next - (fl.Offset + fl.Size)
+		l.Padding += fl.Padding
+		l.Fields = append(l.Fields, fl)
+	}
+	if len(fields) == 0 {
+		l.Padding = l.Size
+	}
+	sorted := append([]*gotypes.Var(nil), fields...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sizes.Alignof(sorted[i].Type()) > sizes.Alignof(sorted[j].Type())
+	})
+	l.SortedSize = sizes.Sizeof(gotypes.NewStruct(sorted, nil))
+	return l
+}
+
+// write prints the layout, one field per line,
+// with padding shown explicitly. Field types are
+// qualified by qual.
+func (l *structLayout) write(out io.Writer, qual qualifier) {
+	fmt.Fprintf(out, "size %d, align %d, padding %d", l.Size, l.Align, l.Padding)
+	if l.SortedSize < l.Size {
+		fmt.Fprintf(out, " (size %d with fields sorted by alignment)", l.SortedSize)
+	}
+	fmt.Fprintf(out, "\n")
+	for _, f := range l.Fields {
+		fmt.Fprintf(out, "\toffset %d, size %d, align %d: %s %v\n", f.Offset, f.Size, f.Align, f.Field.Name(), pretty{f.Field.Type(), qual})
+		if f.Padding > 0 {
+			fmt.Fprintf(out, "\toffset %d, size %d: padding\n", f.Offset+f.Size, f.Padding)
+		}
+	}
+}
+
+// layoutSizes returns the sizes for the architecture
+// named by the -arch flag.
+func layoutSizes() (gotypes.Sizes, error) {
+	sizes := gotypes.SizesFor("gc", *archFlag)
+	if sizes == nil {
+		return nil, fmt.Errorf("unknown architecture %q", *archFlag)
+	}
+	return sizes, nil
+}
+
+// printLayout prints the layout of the type of obj if it is a struct.
+// Only types from the go/packages implementation have sizes.
+func printLayout(out io.Writer, obj *Object) error {
+	t, ok := obj.Type.(gotypes.Type)
+	if !ok {
+		return nil
+	}
+	sizes, err := layoutSizes()
+	if err != nil {
+		return err
+	}
+	if l := layoutOf(t, sizes); l != nil {
+		l.write(out, obj.qual)
+	}
+	return nil
+}
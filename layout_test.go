@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	gotypes "go/types"
+	"testing"
+)
+
+const layoutSrc = `package p
+
+type T struct {
+	a bool
+	b int64
+	c bool
+	d *int
+}
+`
+
+var layoutTests = []struct {
+	arch string
+	want string
+}{{
+	arch: "amd64",
+	want: `size 32, align 8, padding 14 (size 24 with fields sorted by alignment)
+	offset 0, size 1, align 1: a bool
+	offset 1, size 7: padding
+	offset 8, size 8, align 8: b int64
+	offset 16, size 1, align 1: c bool
+	offset 17, size 7: padding
+	offset 24, size 8, align 8: d *int
+`,
+}, {
+	arch: "386",
+	want: `size 20, align 4, padding 6 (size 16 with fields sorted by alignment)
+	offset 0, size 1, align 1: a bool
+	offset 1, size 3: padding
+	offset 4, size 8, align 4: b int64
+	offset 12, size 1, align 1: c bool
+	offset 13, size 3: padding
+	offset 16, size 4, align 4: d *int
+`,
+}}
+
+func TestLayout(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "p.go", layoutSrc, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var conf gotypes.Config
+	pkg, err := conf.Check("p", fset, []*ast.File{f}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	typ := pkg.Scope().Lookup("T").Type()
+	for _, test := range layoutTests {
+		l := layoutOf(typ, gotypes.SizesFor("gc", test.arch))
+		if l == nil {
+			t.Fatalf("no layout for %v", typ)
+		}
+		var buf bytes.Buffer
+		l.write(&buf, nil)
+		if got := buf.String(); got != test.want {
+			t.Errorf("unexpected layout for %s; got\n%s\nwant\n%s", test.arch, got, test.want)
+		}
+	}
+	if l := layoutOf(gotypes.Typ[gotypes.Int], gotypes.SizesFor("gc", "amd64")); l != nil {
+		t.Errorf("got layout for int")
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// outlineSymbol holds one node in the outline of a file.
+type outlineSymbol struct {
+	Name           string           `json:"name"`
+	Kind           Kind             `json:"kind"`
+	Detail         string           `json:"detail,omitempty"`
+	Range          Range            `json:"range"`
+	SelectionRange Range            `json:"selectionRange"`
+	Children       []*outlineSymbol `json:"children,omitempty"`
+}
+
+// outline returns the declarations in the given file as a tree:
+// types hold their fields and methods, and functions, constants
+// and variables are at the top level. The declarations
+// are taken from the syntax; the details from the types.
+func outline(cfg *packages.Config, filename string, src []byte) ([]*outlineSymbol, error) {
+	isInputFile := newFileCompare(filename)
+	var input *ast.File
+	if src != nil {
+		if _, err := os.Stat(filename); err != nil {
+			cfg.Overlay = map[string][]byte{
+				filename: src,
+			}
+		}
+	}
+	cfg.Mode = packages.LoadSyntax
+	cfg.ParseFile = func(fset *token.FileSet, fname string, filedata []byte) (*ast.File, error) {
+		isInput := isInputFile(fname)
+		if isInput && src != nil {
+			// As in highlights, substitute the unsaved contents
+			// here rather than with an overlay, which would cause
+			// every dependency to be type checked from source.
+			filedata = src
+		}
+		file, err := parser.ParseFile(fset, fname, filedata, 0)
+		if file == nil {
+			return nil, err
+		}
+		if isInput {
+			input = file
+		} else {
+			// Only the declarations in other files matter.
+			trimAST(file, token.NoPos)
+		}
+		return file, err
+	}
+	lpkgs, err := packages.Load(cfg, "file="+filename)
+	if err != nil {
+		return nil, err
+	}
+	if len(lpkgs) < 1 || input == nil {
+		return nil, fmt.Errorf("no package found containing %s", filename)
+	}
+	qual := importQualifier(filename, src, lpkgs[0].PkgPath)
+	o := &outliner{
+		fset: lpkgs[0].Fset,
+		info: lpkgs[0].TypesInfo,
+		qual: func(p *types.Package) string {
+			return qual(p.Path(), p.Name())
+		},
+		types: make(map[string]*outlineSymbol),
+	}
+	return o.file(input), nil
+}
+
+type outliner struct {
+	fset  *token.FileSet
+	info  *types.Info
+	qual  types.Qualifier
+	types map[string]*outlineSymbol
+}
+
+func (o *outliner) file(f *ast.File) []*outlineSymbol {
+	var syms []*outlineSymbol
+	// Add types first so that methods can be attached to
+	// them regardless of the order of declaration.
+	for _, decl := range f.Decls {
+		if decl, ok := decl.(*ast.GenDecl); ok && decl.Tok == token.TYPE {
+			for _, spec := range decl.Specs {
+				spec := spec.(*ast.TypeSpec)
+				sym := o.typeSpec(decl, spec)
+				o.types[spec.Name.Name] = sym
+			}
+		}
+	}
+	for _, decl := range f.Decls {
+		switch decl := decl.(type) {
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					syms = append(syms, o.types[spec.Name.Name])
+				case *ast.ValueSpec:
+					syms = append(syms, o.valueSpec(decl, spec)...)
+				}
+			}
+		case *ast.FuncDecl:
+			sym := &outlineSymbol{
+				Name:           decl.Name.Name,
+				Kind:           FuncKind,
+				Detail:         o.typeOf(decl.Name),
+				Range:          o.rangeOf(decl),
+				SelectionRange: o.rangeOf(decl.Name),
+			}
+			if decl.Recv == nil || len(decl.Recv.List) == 0 {
+				syms = append(syms, sym)
+				break
+			}
+			sym.Kind = MethodKind
+			recv := recvTypeName(decl.Recv.List[0].Type)
+			if t := o.types[recv]; t != nil {
+				t.Children = append(t.Children, sym)
+			} else {
+				sym.Name = recv + "." + sym.Name
+				syms = append(syms, sym)
+			}
+		}
+	}
+	return syms
+}
+
+func (o *outliner) typeSpec(decl *ast.GenDecl, spec *ast.TypeSpec) *outlineSymbol {
+	sym := &outlineSymbol{
+		Name:           spec.Name.Name,
+		Kind:           TypeKind,
+		Range:          o.specRange(decl, spec),
+		SelectionRange: o.rangeOf(spec.Name),
+	}
+	if obj := o.info.Defs[spec.Name]; obj != nil {
+		switch t := obj.Type().Underlying().(type) {
+		case *types.Struct:
+			sym.Detail = "struct"
+		case *types.Interface:
+			sym.Detail = "interface"
+		default:
+			sym.Detail = types.TypeString(t, o.qual)
+		}
+	}
+	switch t := spec.Type.(type) {
+	case *ast.StructType:
+		for _, field := range t.Fields.List {
+			sym.Children = append(sym.Children, o.fields(field, FieldKind)...)
+		}
+	case *ast.InterfaceType:
+		for _, field := range t.Methods.List {
+			sym.Children = append(sym.Children, o.fields(field, MethodKind)...)
+		}
+	}
+	return sym
+}
+
+// fields returns a symbol for each name declared by field.
+func (o *outliner) fields(field *ast.Field, kind Kind) []*outlineSymbol {
+	var syms []*outlineSymbol
+	names := field.Names
+	if len(names) == 0 {
+		// An embedded field or interface is named after its type.
+		if name := embeddedName(field.Type); name != nil {
+			names = []*ast.Ident{name}
+		}
+		if kind == MethodKind {
+			kind = TypeKind
+		}
+	}
+	for _, name := range names {
+		syms = append(syms, &outlineSymbol{
+			Name:           name.Name,
+			Kind:           kind,
+			Detail:         o.typeOf(name),
+			Range:          o.rangeOf(field),
+			SelectionRange: o.rangeOf(name),
+		})
+	}
+	return syms
+}
+
+func (o *outliner) valueSpec(decl *ast.GenDecl, spec *ast.ValueSpec) []*outlineSymbol {
+	kind := VarKind
+	if decl.Tok == token.CONST {
+		kind = ConstKind
+	}
+	var syms []*outlineSymbol
+	for _, name := range spec.Names {
+		if name.Name == "_" {
+			continue
+		}
+		syms = append(syms, &outlineSymbol{
+			Name:           name.Name,
+			Kind:           kind,
+			Detail:         o.typeOf(name),
+			Range:          o.specRange(decl, spec),
+			SelectionRange: o.rangeOf(name),
+		})
+	}
+	return syms
+}
+
+// typeOf returns the type of the object defined or used by id.
+func (o *outliner) typeOf(id *ast.Ident) string {
+	obj := o.info.ObjectOf(id)
+	if obj == nil {
+		return ""
+	}
+	return types.TypeString(obj.Type(), o.qual)
+}
+
+// specRange returns the range of a spec, including the
+// declaration keyword if the spec is not parenthesized.
+func (o *outliner) specRange(decl *ast.GenDecl, spec ast.Spec) Range {
+	if !decl.Lparen.IsValid() {
+		return o.rangeOf(decl)
+	}
+	return o.rangeOf(spec)
+}
+
+func (o *outliner) rangeOf(n ast.Node) Range {
+	return Range{
+		Start: o.position(n.Pos()),
+		End:   o.position(n.End()),
+	}
+}
+
+func (o *outliner) position(p token.Pos) Position {
+	pos := o.fset.Position(p)
+	return Position{
+		Line:   pos.Line,
+		Column: pos.Column,
+	}
+}
+
+// recvTypeName returns the name of the type
+// in a method receiver type expression.
+func recvTypeName(e ast.Expr) string {
+	for {
+		switch t := e.(type) {
+		case *ast.StarExpr:
+			e = t.X
+		case *ast.ParenExpr:
+			e = t.X
+		case *ast.IndexExpr:
+			e = t.X
+		case *ast.IndexListExpr:
+			e = t.X
+		case *ast.Ident:
+			return t.Name
+		default:
+			return ""
+		}
+	}
+}
+
+// embeddedName returns the identifier that names
+// an embedded field with the given type.
+func embeddedName(e ast.Expr) *ast.Ident {
+	for {
+		switch t := e.(type) {
+		case *ast.StarExpr:
+			e = t.X
+		case *ast.SelectorExpr:
+			return t.Sel
+		case *ast.IndexExpr:
+			e = t.X
+		case *ast.IndexListExpr:
+			e = t.X
+		case *ast.Ident:
+			return t
+		default:
+			return nil
+		}
+	}
+}
+
+func printOutline(out io.Writer, syms []*outlineSymbol) error {
+	if syms == nil {
+		syms = []*outlineSymbol{}
+	}
+	jsonStr, err := json.Marshal(syms)
+	if err != nil {
+		return fmt.Errorf("JSON marshal error: %v", err)
+	}
+	fmt.Fprintf(out, "%s\n", jsonStr)
+	return nil
+}
@@ -6,15 +6,19 @@ import (
 	"go/parser"
 	"go/token"
 	"go/types"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 
 	"golang.org/x/tools/go/ast/astutil"
 	"golang.org/x/tools/go/packages"
 )
 
-func godefPackages(cfg *packages.Config, filename string, src []byte, searchpos int) (*token.FileSet, types.Object, error) {
+// godefPackages returns the object referred to by the identifier at
+// searchpos in the given file, along with the package containing the file.
+func godefPackages(cfg *packages.Config, filename string, src []byte, searchpos int) (*token.FileSet, *types.Package, types.Object, error) {
 	parser, result := parseFile(filename, searchpos)
 	// Load, parse, and type-check the packages named on the command line.
 	if src != nil {
@@ -26,31 +30,47 @@ func godefPackages(cfg *packages.Config, filename string, src []byte, searchpos
 	cfg.ParseFile = parser
 	lpkgs, err := packages.Load(cfg, "file="+filename)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 	if len(lpkgs) < 1 {
-		return nil, nil, fmt.Errorf("There must be at least one package that contains the file")
+		return nil, nil, nil, fmt.Errorf("There must be at least one package that contains the file")
 	}
 	// get the node
 	var m match
 	select {
 	case m = <-result:
 	default:
-		return nil, nil, fmt.Errorf("no file found at search pos %d", searchpos)
+		return nil, nil, nil, fmt.Errorf("no file found at search pos %d", searchpos)
 	}
+	obj, err := matchObject(lpkgs[0], m, searchpos)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return lpkgs[0].Fset, lpkgs[0].Types, obj, nil
+}
+
+// matchObject returns the object referred to by the identifier
+// in m, found at searchpos in a file of pkg.
+func matchObject(pkg *packages.Package, m match, searchpos int) (types.Object, error) {
 	if m.ident == nil {
-		return nil, nil, fmt.Errorf("Offset %d was not a valid identifier", searchpos)
+		return nil, fmt.Errorf("Offset %d was not a valid identifier", searchpos)
 	}
-	obj := lpkgs[0].TypesInfo.ObjectOf(m.ident)
+	obj := pkg.TypesInfo.ObjectOf(m.ident)
 	if obj == nil && !m.ident.Pos().IsValid() {
-		pkg := lpkgs[0].Imports[m.ident.Name]
-		if pkg != nil && len(pkg.GoFiles) > 0 {
-			dir := filepath.Dir(pkg.GoFiles[0])
+		ipkg := pkg.Imports[m.ident.Name]
+		if ipkg != nil && len(ipkg.GoFiles) > 0 {
+			dir := filepath.Dir(ipkg.GoFiles[0])
 			obj = types.NewPkgName(token.NoPos, nil, "", types.NewPackage(dir, ""))
 		}
 	}
+	if obj == nil && m.keyLit != nil {
+		// The type checker does not record keys in some
+		// invalid literals, such as those that mix keyed
+		// and positional elements.
+		obj = litField(pkg.TypesInfo.TypeOf(m.keyLit), m.ident.Name)
+	}
 	if obj == nil {
-		return nil, nil, fmt.Errorf("no object")
+		return nil, fmt.Errorf("no object")
 	}
 	if m.wasEmbeddedField {
 		// the original position was on the embedded field declaration
@@ -61,13 +81,38 @@ func godefPackages(cfg *packages.Config, filename string, src []byte, searchpos
 			}
 		}
 	}
-	return lpkgs[0].Fset, obj, nil
+	return obj, nil
+}
+
+// litField returns the field of the struct type t, or the
+// struct type that t points to, with the given name.
+func litField(t types.Type, name string) types.Object {
+	if t == nil {
+		return nil
+	}
+	if p, ok := t.Underlying().(*types.Pointer); ok {
+		t = p.Elem()
+	}
+	st, ok := t.Underlying().(*types.Struct)
+	if !ok {
+		return nil
+	}
+	for i := 0; i < st.NumFields(); i++ {
+		if f := st.Field(i); f.Name() == name {
+			return f
+		}
+	}
+	return nil
 }
 
 // match holds the ident plus any extra information needed
 type match struct {
 	ident            *ast.Ident
 	wasEmbeddedField bool
+
+	// keyLit holds the composite literal that
+	// ident is a key in, if any.
+	keyLit *ast.CompositeLit
 }
 
 // parseFile returns a function that can be used as a Parser in packages.Config
@@ -148,6 +193,11 @@ func checkMatch(f *ast.File, pos token.Pos) (match, error) {
 	switch node := path[0].(type) {
 	case *ast.Ident:
 		result.ident = node
+		if len(path) > 2 {
+			if kv, ok := path[1].(*ast.KeyValueExpr); ok && kv.Key == node {
+				result.keyLit, _ = path[2].(*ast.CompositeLit)
+			}
+		}
 	case *ast.SelectorExpr:
 		result.ident = node.Sel
 	case *ast.BasicLit:
@@ -207,3 +257,42 @@ func isEllipsisArray(n ast.Expr) bool {
 	_, ok = at.Len.(*ast.Ellipsis)
 	return ok
 }
+
+// moduleRoot returns the root directory of the module
+// containing dir, or dir itself if it is not inside a module.
+func moduleRoot(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return dir
+	}
+	for d := dir; ; {
+		if _, err := os.Stat(filepath.Join(d, "go.mod")); err == nil {
+			return d
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return dir
+		}
+		d = parent
+	}
+}
+
+// modulePath returns the module path declared in the
+// go.mod file in dir, or "" if there is none.
+func modulePath(dir string) string {
+	data, err := ioutil.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "module" {
+			continue
+		}
+		if path, err := strconv.Unquote(fields[1]); err == nil {
+			return path
+		}
+		return fields[1]
+	}
+	return ""
+}
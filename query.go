@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// queryCandidate holds one possible interpretation of a
+// qualified name query.
+type queryCandidate struct {
+	path  string
+	names []string
+}
+
+// godefQuery finds the declaration named by query, which is of the
+// form importpath.Name or importpath.Name.Member. Only the package
+// named by the import path is loaded. If query holds only an import
+// path, the package directory is returned.
+func godefQuery(cfg *packages.Config, query string) (*token.FileSet, types.Object, error) {
+	cands := queryCandidates(query)
+	if len(cands) == 0 {
+		return nil, nil, fmt.Errorf("invalid query %q", query)
+	}
+	paths := make([]string, len(cands))
+	for i, c := range cands {
+		paths[i] = c.path
+	}
+	qcfg := *cfg
+	qcfg.Mode = packages.NeedName | packages.NeedFiles | packages.NeedTypes
+	qcfg.ParseFile = nil
+	// An overlay would force the package to be type checked
+	// from source, and a query never refers to unsaved files.
+	qcfg.Overlay = nil
+	lpkgs, err := packages.Load(&qcfg, paths...)
+	if err != nil {
+		return nil, nil, err
+	}
+	// A package that fails to compile has no export data, so
+	// it is type checked from source, which needs the types
+	// of its dependencies. Load those only when needed.
+	var retry []string
+	for _, pkg := range lpkgs {
+		if len(pkg.GoFiles) > 0 && len(pkg.Errors) > 0 {
+			retry = append(retry, pkg.PkgPath)
+		}
+	}
+	if len(retry) > 0 {
+		qcfg.Mode |= packages.NeedImports | packages.NeedDeps
+		rpkgs, err := packages.Load(&qcfg, retry...)
+		if err != nil {
+			return nil, nil, err
+		}
+		lpkgs = append(lpkgs, rpkgs...)
+	}
+	byPath := make(map[string]*packages.Package)
+	for _, pkg := range lpkgs {
+		// A package that fails to compile may still provide
+		// useful declarations, so only ignore packages
+		// that do not exist. Later packages, loaded with
+		// their dependencies, replace earlier ones.
+		if len(pkg.GoFiles) > 0 && pkg.Types != nil {
+			byPath[pkg.PkgPath] = pkg
+		}
+	}
+	// The candidates are ordered longest import path first,
+	// so the first one found is the most specific.
+	for _, c := range cands {
+		pkg := byPath[c.path]
+		if pkg == nil {
+			continue
+		}
+		if len(c.names) == 0 {
+			if len(pkg.GoFiles) == 0 {
+				continue
+			}
+			dir := filepath.Dir(pkg.GoFiles[0])
+			return pkg.Fset, types.NewPkgName(token.NoPos, nil, "", types.NewPackage(dir, "")), nil
+		}
+		obj, err := lookupQualified(pkg.Types, c.names)
+		if err != nil {
+			// The declaration may be missing only
+			// because the package failed to load.
+			if perr := packageErrors(pkg); perr != nil {
+				return nil, nil, perr
+			}
+			return nil, nil, err
+		}
+		return pkg.Fset, obj, nil
+	}
+	return nil, nil, fmt.Errorf("no package found for %q", query)
+}
+
+// packageErrors returns an error describing the errors
+// encountered loading pkg, or nil if there were none.
+func packageErrors(pkg *packages.Package) error {
+	if len(pkg.Errors) == 0 {
+		return nil
+	}
+	// The go command's compiler output repeats the
+	// type checker's errors less clearly, so it is
+	// only used when there are no others.
+	var msgs, listMsgs []string
+	for _, e := range pkg.Errors {
+		if e.Kind == packages.ListError {
+			listMsgs = append(listMsgs, e.Error())
+		} else {
+			msgs = append(msgs, e.Error())
+		}
+	}
+	if len(msgs) == 0 {
+		msgs = listMsgs
+	}
+	return fmt.Errorf("cannot load %s:\n\t%s", pkg.PkgPath, strings.Join(msgs, "\n\t"))
+}
+
+// queryCandidates returns all the ways that query can be split
+// into an import path and a list of one or two names, longest
+// import path first. The package path itself may contain dots
+// (for example gopkg.in/yaml.v2), so all splits after the last
+// slash are tried.
+func queryCandidates(query string) []queryCandidate {
+	var cands []queryCandidate
+	if query == "" {
+		return nil
+	}
+	cands = append(cands, queryCandidate{path: query})
+	start := strings.LastIndex(query, "/") + 1
+	for i := len(query) - 1; i > start; i-- {
+		if query[i] != '.' {
+			continue
+		}
+		names := strings.Split(query[i+1:], ".")
+		if len(names) > 2 || !allIdents(names) {
+			continue
+		}
+		cands = append(cands, queryCandidate{
+			path:  query[:i],
+			names: names,
+		})
+	}
+	return cands
+}
+
+func allIdents(names []string) bool {
+	for _, name := range names {
+		if !token.IsIdentifier(name) {
+			return false
+		}
+	}
+	return true
+}
+
+// lookupQualified looks up names[0] in the scope of pkg and, if
+// there is a second name, the field or method of that name.
+func lookupQualified(pkg *types.Package, names []string) (types.Object, error) {
+	obj := pkg.Scope().Lookup(names[0])
+	if obj == nil {
+		return nil, fmt.Errorf("no declaration of %s in %s", names[0], pkg.Path())
+	}
+	if len(names) == 1 {
+		return obj, nil
+	}
+	member, _, _ := types.LookupFieldOrMethod(obj.Type(), true, pkg, names[1])
+	if member == nil {
+		return nil, fmt.Errorf("no field or method %s in %s.%s", names[1], pkg.Path(), names[0])
+	}
+	return member, nil
+}
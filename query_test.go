@@ -0,0 +1,69 @@
+package main
+
+import (
+	"go/types"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rogpeppe/godef/internal/testfiles"
+	"golang.org/x/tools/go/packages"
+)
+
+var queryFiles = map[string]string{
+	"go.mod": "module example.com/m\n",
+	"a/a.go": `package a
+
+import "strings"
+
+var B strings.Builder
+
+func F() { undefined() }
+`,
+}
+
+var queryTests = []struct {
+	query string
+	want  string
+	err   string
+}{{
+	// A broken package may still provide
+	// the declaration asked for.
+	query: "example.com/m/a.F",
+	want:  "func()",
+}, {
+	// The package is type checked from source,
+	// which needs the types of its imports.
+	query: "example.com/m/a.B",
+	want:  "strings.Builder",
+}, {
+	// A declaration that is missing may be missing
+	// because of the package's errors.
+	query: "example.com/m/a.G",
+	err:   "undefined: undefined",
+}, {
+	query: "example.com/m/nonexistent.F",
+	err:   `no package found for "example.com/m/nonexistent.F"`,
+}}
+
+func TestQuery(t *testing.T) {
+	dir := testfiles.Write(t, queryFiles)
+	defer os.RemoveAll(dir)
+	cfg := &packages.Config{Dir: dir}
+	for _, test := range queryTests {
+		_, obj, err := godefQuery(cfg, test.query)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: got error %v; want error containing %q", test.query, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.query, err)
+			continue
+		}
+		if got := types.TypeString(obj.Type(), nil); got != test.want {
+			t.Errorf("%s: got type %s; want %s", test.query, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// refKind classifies a reference to an object.
+type refKind string
+
+const (
+	declRef  refKind = "declaration"
+	readRef  refKind = "read"
+	writeRef refKind = "write"
+	addrRef  refKind = "address"
+)
+
+// reference holds a reference to an object
+// and how the object is used there.
+type reference struct {
+	Range Range   `json:"range"`
+	Kind  refKind `json:"kind"`
+}
+
+// moduleReferences returns all the references in the main module,
+// including its tests, to the object identified at searchpos in
+// the given file, sorted by position. Unlike highlights, it type
+// checks all the packages in the module from source.
+func moduleReferences(cfg *packages.Config, filename string, src []byte, searchpos int) ([]reference, error) {
+	filename, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	isInputFile := newFileCompare(filename)
+	rcfg := *cfg
+	rcfg.Overlay = nil
+	if src != nil {
+		if _, err := os.Stat(filename); err != nil {
+			rcfg.Overlay = map[string][]byte{
+				filename: src,
+			}
+		}
+	}
+	if rcfg.Dir == "" {
+		rcfg.Dir = filepath.Dir(filename)
+	}
+	rcfg.Dir = moduleRoot(rcfg.Dir)
+	rcfg.Mode = packages.LoadSyntax
+	rcfg.Tests = true
+	var input *ast.File
+	rcfg.ParseFile = func(fset *token.FileSet, fname string, filedata []byte) (*ast.File, error) {
+		if !isInputFile(fname) {
+			return parser.ParseFile(fset, fname, filedata, 0)
+		}
+		if src != nil {
+			filedata = src
+		}
+		file, err := parser.ParseFile(fset, fname, filedata, 0)
+		input = file
+		return file, err
+	}
+	lpkgs, err := packages.Load(&rcfg, "./...", "file="+filename)
+	if err != nil {
+		return nil, err
+	}
+	return packagesReferences(lpkgs, filename, input, searchpos)
+}
+
+// packagesReferences returns the references in lpkgs to the object
+// identified at searchpos in input, the syntax of the given file
+// in one of the packages, sorted by position.
+func packagesReferences(lpkgs []*packages.Package, filename string, input *ast.File, searchpos int) ([]reference, error) {
+	var pkg *packages.Package
+	for _, p := range lpkgs {
+		for _, f := range p.Syntax {
+			if f == input {
+				pkg = p
+			}
+		}
+	}
+	if pkg == nil {
+		return nil, fmt.Errorf("no package found containing %s", filename)
+	}
+	tfile := pkg.Fset.File(input.Pos())
+	if searchpos < 0 || searchpos > tfile.Size() {
+		return nil, fmt.Errorf("cursor %d is beyond end of file %s (%d)", searchpos, filename, tfile.Size())
+	}
+	m, err := findMatch(input, tfile.Pos(searchpos))
+	if err != nil {
+		return nil, err
+	}
+	if m.ident == nil {
+		return nil, fmt.Errorf("offset %d was not a valid identifier", searchpos)
+	}
+	targets := refTargets(pkg.Fset, pkg.TypesInfo, input, m.ident)
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no object for %s", m.ident.Name)
+	}
+	// A file may be type checked more than once, for
+	// example in both p and p [p.test], so skip
+	// references that have already been found.
+	var refs []reference
+	seen := make(map[Position]bool)
+	for _, p := range lpkgs {
+		for _, f := range p.Syntax {
+			for _, r := range fileReferences(p.Fset, p.TypesInfo, f, targets) {
+				if !seen[r.Range.Start] {
+					seen[r.Range.Start] = true
+					refs = append(refs, r)
+				}
+			}
+		}
+	}
+	sort.SliceStable(refs, func(i, j int) bool {
+		pi, pj := refs[i].Range.Start, refs[j].Range.Start
+		if pi.Filename != pj.Filename {
+			return pi.Filename < pj.Filename
+		}
+		if pi.Line != pj.Line {
+			return pi.Line < pj.Line
+		}
+		return pi.Column < pj.Column
+	})
+	return refs, nil
+}
+
+// printReferences prints the references found by highlights or
+// moduleReferences, one per line, or as a JSON array if the
+// -json flag is set.
+func printReferences(out io.Writer, refs []reference) error {
+	if *jsonFlag {
+		if refs == nil {
+			refs = []reference{}
+		}
+		jsonStr, err := json.Marshal(refs)
+		if err != nil {
+			return fmt.Errorf("JSON marshal error: %v", err)
+		}
+		fmt.Fprintf(out, "%s\n", jsonStr)
+		return nil
+	}
+	for _, r := range refs {
+		fmt.Fprintf(out, "%v-%d:%d\t%s\n", r.Range.Start, r.Range.End.Line, r.Range.End.Column, r.Kind)
+	}
+	return nil
+}
+
+// refKey identifies an object by the position of its declaration,
+// as xref's declPos does, so that an object matches its counterparts
+// in other type checked variants of the same package, such as
+// p and p [p.test]. Objects with no position, such as those in
+// the universe scope, are identified by the object itself.
+type refKey struct {
+	filename     string
+	line, column int
+	obj          types.Object
+}
+
+// objKey returns the key identifying obj.
+func objKey(fset *token.FileSet, obj types.Object) refKey {
+	obj = originObj(obj)
+	if !obj.Pos().IsValid() {
+		return refKey{obj: obj}
+	}
+	return posKey(fset, obj.Pos())
+}
+
+// posKey returns the key identifying an object declared at p.
+func posKey(fset *token.FileSet, p token.Pos) refKey {
+	pos := fset.Position(p)
+	return refKey{filename: cleanFilename(pos.Filename), line: pos.Line, column: pos.Column}
+}
+
+// refTargets returns the keys of the objects that the identifier
+// id in file refers to. Usually there is only one, but the variable
+// declared in a type switch guard has a different object in each
+// case clause, and none of its own, so those are all returned.
+// They are all declared at the position of the guard, which is
+// returned too so that the guard itself can be found.
+func refTargets(fset *token.FileSet, info *types.Info, file *ast.File, id *ast.Ident) map[refKey]bool {
+	targets := make(map[refKey]bool)
+	if obj := info.ObjectOf(id); obj != nil {
+		targets[objKey(fset, obj)] = true
+	}
+	ast.Inspect(file, func(n ast.Node) bool {
+		ts, ok := n.(*ast.TypeSwitchStmt)
+		if !ok {
+			return true
+		}
+		guard := typeSwitchIdent(ts)
+		objs := typeSwitchObjects(info, ts)
+		found := guard != nil && guard == id
+		for _, obj := range objs {
+			found = found || targets[objKey(fset, obj)]
+		}
+		if found {
+			for _, obj := range objs {
+				targets[objKey(fset, obj)] = true
+			}
+			if guard != nil {
+				targets[posKey(fset, guard.Pos())] = true
+			}
+		}
+		return true
+	})
+	return targets
+}
+
+// fileReferences returns the references in file to the objects
+// found by refTargets, in source order, classified by classifyRef.
+func fileReferences(fset *token.FileSet, info *types.Info, file *ast.File, targets map[refKey]bool) []reference {
+	var refs []reference
+	inspectIdents(file, func(id *ast.Ident, path []ast.Node) {
+		key := posKey(fset, id.Pos())
+		if obj := info.ObjectOf(id); obj != nil {
+			key = objKey(fset, obj)
+		}
+		if !targets[key] {
+			return
+		}
+		refs = append(refs, reference{
+			Range: Range{
+				Start: goPosition(fset, id.Pos()),
+				End:   goPosition(fset, id.End()),
+			},
+			Kind: classifyRef(info, id, path),
+		})
+	})
+	return refs
+}
+
+// inspectIdents calls f for each identifier in file, in source
+// order, with the nodes enclosing it, innermost first.
+func inspectIdents(file *ast.File, f func(id *ast.Ident, path []ast.Node)) {
+	var stack []ast.Node
+	ast.Inspect(file, func(n ast.Node) bool {
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return false
+		}
+		stack = append(stack, n)
+		if id, ok := n.(*ast.Ident); ok {
+			path := make([]ast.Node, len(stack))
+			for i, n := range stack {
+				path[len(stack)-1-i] = n
+			}
+			f(id, path)
+		}
+		return true
+	})
+}
+
+// originObj returns the generic object that obj was instantiated
+// from, so that references through different instantiations of
+// a generic type or function are treated as the same.
+func originObj(obj types.Object) types.Object {
+	switch obj := obj.(type) {
+	case *types.Var:
+		return obj.Origin()
+	case *types.Func:
+		return obj.Origin()
+	}
+	return obj
+}
+
+// classifyRef reports how the identifier id is used: whether it
+// declares an object, or the variable it refers to, or any part
+// of it, is assigned to or has its address taken. The path
+// holds the nodes enclosing id, innermost first, as returned
+// by astutil.PathEnclosingInterval.
+func classifyRef(info *types.Info, id *ast.Ident, path []ast.Node) refKind {
+	if info.Defs[id] != nil {
+		return declRef
+	}
+	for i, n := range path {
+		if n == id {
+			path = path[i+1:]
+			break
+		}
+	}
+	if len(path) > 1 {
+		if ts, ok := path[1].(*ast.TypeSwitchStmt); ok && typeSwitchIdent(ts) == id {
+			// The symbolic variable in a type switch guard
+			// has no object of its own.
+			return declRef
+		}
+	}
+	var e ast.Expr = id
+	if len(path) > 0 {
+		if sel, ok := path[0].(*ast.SelectorExpr); ok && sel.Sel == id {
+			e, path = sel, path[1:]
+		}
+	}
+	// Find the outermost expression that denotes the same
+	// variable or part of it. Assigning to a field of a struct
+	// value or an element of an array value also writes
+	// to the value itself.
+loop:
+	for len(path) > 0 {
+		switch p := path[0].(type) {
+		case *ast.ParenExpr:
+		case *ast.SelectorExpr:
+			if p.X != e || !hasUnderlying(info, e, isStruct) {
+				break loop
+			}
+		case *ast.IndexExpr:
+			if p.X != e || !hasUnderlying(info, e, isArray) {
+				break loop
+			}
+		default:
+			break loop
+		}
+		e, path = path[0].(ast.Expr), path[1:]
+	}
+	if len(path) == 0 {
+		return readRef
+	}
+	switch p := path[0].(type) {
+	case *ast.AssignStmt:
+		for _, lhs := range p.Lhs {
+			if lhs == e {
+				return writeRef
+			}
+		}
+	case *ast.IncDecStmt:
+		if p.X == e {
+			return writeRef
+		}
+	case *ast.RangeStmt:
+		if p.Key == e || p.Value == e {
+			return writeRef
+		}
+	case *ast.UnaryExpr:
+		if p.Op == token.AND && p.X == e {
+			return addrRef
+		}
+	}
+	return readRef
+}
+
+func hasUnderlying(info *types.Info, e ast.Expr, pred func(types.Type) bool) bool {
+	t := info.TypeOf(e)
+	return t != nil && pred(t.Underlying())
+}
+
+func isStruct(t types.Type) bool {
+	_, ok := t.(*types.Struct)
+	return ok
+}
+
+func isArray(t types.Type) bool {
+	_, ok := t.(*types.Array)
+	return ok
+}
+
+// typeSwitchIdent returns the identifier declared by a type switch
+// guard such as "switch x := y.(type)", or nil if there is none.
+func typeSwitchIdent(ts *ast.TypeSwitchStmt) *ast.Ident {
+	assign, ok := ts.Assign.(*ast.AssignStmt)
+	if !ok || len(assign.Lhs) != 1 {
+		return nil
+	}
+	id, _ := assign.Lhs[0].(*ast.Ident)
+	return id
+}
+
+// typeSwitchObjects returns the implicit objects declared
+// in each clause of a type switch with a symbolic variable.
+func typeSwitchObjects(info *types.Info, ts *ast.TypeSwitchStmt) []types.Object {
+	var objs []types.Object
+	for _, stmt := range ts.Body.List {
+		if obj := info.Implicits[stmt]; obj != nil {
+			objs = append(objs, obj)
+		}
+	}
+	return objs
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rogpeppe/godef/internal/testfiles"
+	"golang.org/x/tools/go/packages"
+)
+
+var refsFiles = map[string]string{
+	"go.mod": "module example.com/m\n",
+	"a/a.go": `package a
+
+type T struct {
+	N int
+}
+
+type Box[E any] struct {
+	V E
+}
+
+func Set(t *T) {
+	t.N = 1
+}
+`,
+	"a/a_test.go": `package a
+
+func init() {
+	Set(&T{N: 2})
+}
+`,
+	"b/b.go": `package b
+
+import "example.com/m/a"
+
+func Use() int {
+	var t a.T
+	p := &t.N
+	t.N++
+	var bi a.Box[int]
+	bi.V = 1
+	var bs a.Box[string]
+	_ = &bs.V
+	return *p + t.N + bi.V
+}
+`,
+}
+
+var refsTests = []struct {
+	file string
+	at   string
+	want string
+}{{
+	file: "a/a.go",
+	at:   "N int",
+	want: "a/a.go:4:2 declaration, a/a.go:12:4 write, a/a_test.go:4:9 read, b/b.go:7:10 address, b/b.go:8:4 write, b/b.go:13:16 read",
+}, {
+	file: "a/a_test.go",
+	at:   "Set(",
+	want: "a/a.go:11:6 declaration, a/a_test.go:4:2 read",
+}, {
+	file: "a/a.go",
+	at:   "V E",
+	want: "a/a.go:8:2 declaration, b/b.go:10:5 write, b/b.go:12:10 address, b/b.go:13:23 read",
+}, {
+	file: "b/b.go",
+	at:   "t a.T",
+	want: "b/b.go:6:6 declaration, b/b.go:7:8 address, b/b.go:8:2 write, b/b.go:13:14 read",
+}}
+
+func TestReferences(t *testing.T) {
+	dir := testfiles.Write(t, refsFiles)
+	defer os.RemoveAll(dir)
+	for _, test := range refsTests {
+		filename := filepath.Join(dir, filepath.FromSlash(test.file))
+		src := refsFiles[test.file]
+		refs, err := moduleReferences(&packages.Config{}, filename, []byte(src), strings.Index(src, test.at))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.at, err)
+			continue
+		}
+		var got []string
+		for _, r := range refs {
+			rel, err := filepath.Rel(dir, r.Range.Start.Filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.Range.Start.Filename = filepath.ToSlash(rel)
+			got = append(got, fmt.Sprintf("%v %s", r.Range.Start, r.Kind))
+		}
+		if strings.Join(got, ", ") != test.want {
+			t.Errorf("%s: got\n\t%s\nwant\n\t%s", test.at, strings.Join(got, ", "), test.want)
+		}
+	}
+}
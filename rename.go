@@ -0,0 +1,856 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/build"
+	gotoken "go/token"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rogpeppe/godef/go/ast"
+	"github.com/rogpeppe/godef/go/parser"
+	"github.com/rogpeppe/godef/go/scanner"
+	"github.com/rogpeppe/godef/go/sym"
+	"github.com/rogpeppe/godef/go/token"
+	"github.com/rogpeppe/godef/go/types"
+)
+
+// rename renames the object referred to by the identifier at
+// searchpos in filename to the name to, in every package in the
+// enclosing module that refers to it. No files are written;
+// the returned map holds the new contents of each changed file,
+// in which every reference is replaced by the new name and all
+// the other bytes are left as they were.
+//
+// Before writing anything, the renamed source is parsed again and
+// every identifier is resolved afresh. If any identifier would
+// refer to a different object than before, if the new name would
+// clash with an existing declaration, or if a type would no longer
+// implement an interface that it implemented before, no files are
+// changed and an error describing the conflicts is returned.
+func rename(filename string, src []byte, searchpos int, to string) (map[string][]byte, error) {
+	if !gotoken.IsIdentifier(to) || to == "_" {
+		return nil, fmt.Errorf("invalid identifier %q", to)
+	}
+	filename, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	if src != nil {
+		// The source is read from disk again when renaming,
+		// so it must be the same as the source we were given.
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(data, src) {
+			return nil, fmt.Errorf("%s has unsaved changes", filename)
+		}
+	}
+	r := &renamer{
+		ctxt:     sym.NewContext(),
+		to:       to,
+		root:     moduleRoot(filepath.Dir(filename)),
+		loaded:   make(map[string][]*renamePkg),
+		pkgOf:    make(map[string]*renamePkg),
+		resolved: make(map[identKey]resolution),
+		renamed:  make(map[*ast.Ident]bool),
+		offsets:  make(map[string][]int),
+		files:    make(map[string]*ast.File),
+	}
+	if err := r.load(filepath.Dir(filename)); err != nil {
+		return nil, err
+	}
+	p := r.pkgOf[filename]
+	if p == nil {
+		return nil, fmt.Errorf("no package found containing %s", filename)
+	}
+	info, err := r.infoAt(p.pkg.Files[filename], searchpos)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.setTarget(info); err != nil {
+		return nil, err
+	}
+	if r.pkgOf[r.target.filename] == nil {
+		return nil, fmt.Errorf("cannot rename %s: %s is not in a package of the module", r.from, r.target.filename)
+	}
+	if err := r.collect(); err != nil {
+		return nil, err
+	}
+	r.checkAccess()
+	r.checkMembers()
+	r.checkInterfaces()
+	if err := r.verify(); err != nil {
+		return nil, err
+	}
+	if len(r.conflicts) > 0 {
+		sort.Strings(r.conflicts)
+		return nil, fmt.Errorf("cannot rename %s to %s:\n\t%s", r.from, r.to, strings.Join(r.conflicts, "\n\t"))
+	}
+	changed := make(map[string][]byte)
+	for name := range r.files {
+		data, err := r.newSource(name)
+		if err != nil {
+			return nil, err
+		}
+		changed[name] = data
+	}
+	return changed, nil
+}
+
+// writeRename prints the changes made by rename as a unified
+// diff if the -diff flag is given, or as a list of edits if the
+// -json flag is given. Otherwise it writes the changed files
+// and prints their names.
+func writeRename(out io.Writer, changed map[string][]byte) error {
+	switch {
+	case *diffFlag:
+		return sym.Diff(out, changed)
+	case *jsonFlag:
+		edits, err := sym.Edits(changed)
+		if err != nil {
+			return err
+		}
+		if edits == nil {
+			edits = []sym.Edit{}
+		}
+		jsonStr, err := json.Marshal(edits)
+		if err != nil {
+			return fmt.Errorf("JSON marshal error: %v", err)
+		}
+		fmt.Fprintf(out, "%s\n", jsonStr)
+		return nil
+	}
+	if err := sym.WriteFilesAtomic(changed); err != nil {
+		return err
+	}
+	var names []string
+	for name := range changed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintln(out, name)
+	}
+	return nil
+}
+
+// renamer holds the state of a rename operation.
+type renamer struct {
+	ctxt     *sym.Context
+	from, to string
+
+	// root holds the root directory of the module.
+	root string
+
+	// pkgs holds the packages that are searched for references.
+	pkgs []*renamePkg
+
+	// loaded holds the packages found in each directory.
+	loaded map[string][]*renamePkg
+
+	// skipBroken causes loadModule to skip packages that
+	// cannot be loaded, recording why in skipped, instead
+	// of failing.
+	skipBroken bool
+	skipped    []error
+
+	// pkgOf maps from filename to the package containing it.
+	pkgOf map[string]*renamePkg
+
+	// target holds the declaration of the object being renamed.
+	target identKey
+	obj    *ast.Object
+
+	// resolved holds the declaration that each identifier
+	// in the searched packages refers to.
+	resolved map[identKey]resolution
+
+	// renamed holds the identifiers to be renamed.
+	renamed map[*ast.Ident]bool
+
+	// offsets holds the offsets of the identifiers
+	// to be renamed, sorted, by filename.
+	offsets map[string][]int
+
+	// files holds the files to be changed.
+	files map[string]*ast.File
+
+	conflicts []string
+}
+
+// renamePkg holds a package searched for references.
+type renamePkg struct {
+	// path holds the import path of the package,
+	// or "" for an external test package.
+	path string
+	dir  string
+	pkg  *ast.Package
+}
+
+// identKey identifies an identifier by its position.
+// The zero identKey stands for the universe scope.
+type identKey struct {
+	filename string
+	offset   int
+}
+
+// resolution records what an identifier refers to.
+type resolution struct {
+	name string
+	pos  token.Position
+	decl identKey
+}
+
+func (r *renamer) conflictf(pos token.Position, f string, a ...interface{}) {
+	r.conflicts = append(r.conflicts, fmt.Sprintf("%v: %s", pos, fmt.Sprintf(f, a...)))
+}
+
+// load loads the package and any external test package
+// in the given directory, if they have not been loaded already.
+func (r *renamer) load(dir string) error {
+	if _, ok := r.loaded[dir]; ok {
+		return nil
+	}
+	r.loaded[dir] = nil
+	bpkg, err := build.ImportDir(dir, 0)
+	if err != nil {
+		if _, ok := err.(*build.NoGoError); ok {
+			return nil
+		}
+		return err
+	}
+	path, err := r.importPath(dir)
+	if err != nil {
+		return err
+	}
+	pkg, err := r.ctxt.Import(path, dir)
+	if err != nil {
+		return fmt.Errorf("cannot load package %q: %v", path, err)
+	}
+	var files []string
+	files = append(files, bpkg.GoFiles...)
+	files = append(files, bpkg.CgoFiles...)
+	files = append(files, bpkg.TestGoFiles...)
+	pkgs := []*renamePkg{{
+		path: path,
+		dir:  dir,
+		pkg:  pkg,
+	}}
+	if len(bpkg.XTestGoFiles) > 0 {
+		xfiles := make([]string, len(bpkg.XTestGoFiles))
+		for i, f := range bpkg.XTestGoFiles {
+			xfiles[i] = filepath.Join(dir, f)
+		}
+		xpkgs, err := parser.ParseFiles(r.ctxt.FileSet, xfiles, parser.ParseComments, nil)
+		if err != nil {
+			return fmt.Errorf("cannot parse %s: %v", dir, err)
+		}
+		for _, xpkg := range xpkgs {
+			pkgs = append(pkgs, &renamePkg{
+				dir: dir,
+				pkg: xpkg,
+			})
+		}
+		files = append(files, bpkg.XTestGoFiles...)
+	}
+	for _, p := range pkgs {
+		for name := range p.pkg.Files {
+			r.pkgOf[name] = p
+		}
+	}
+	// We cannot rename references in any files
+	// that the importer did not find.
+	for _, f := range files {
+		if name := filepath.Join(dir, f); r.pkgOf[name] == nil {
+			return fmt.Errorf("cannot parse %s", name)
+		}
+	}
+	r.loaded[dir] = pkgs
+	r.pkgs = append(r.pkgs, pkgs...)
+	return nil
+}
+
+// importPath returns the import path of the package in dir.
+func (r *renamer) importPath(dir string) (string, error) {
+	if mpath := modulePath(r.root); mpath != "" {
+		rel, err := filepath.Rel(r.root, dir)
+		if err != nil {
+			return "", err
+		}
+		if rel == "." {
+			return mpath, nil
+		}
+		return mpath + "/" + filepath.ToSlash(rel), nil
+	}
+	bpkg, err := build.ImportDir(dir, build.FindOnly)
+	if err != nil {
+		return "", err
+	}
+	if build.IsLocalImport(bpkg.ImportPath) {
+		return "", fmt.Errorf("cannot determine import path of %s", dir)
+	}
+	return bpkg.ImportPath, nil
+}
+
+// infoAt returns information on the identifier at
+// the given offset in f.
+func (r *renamer) infoAt(f *ast.File, searchpos int) (*sym.Info, error) {
+	var found *sym.Info
+	r.ctxt.IterateSyms(f, func(info *sym.Info) bool {
+		off := r.ctxt.FileSet.Position(info.Ident.Pos()).Offset
+		if off <= searchpos && searchpos <= off+len(info.Ident.Name) {
+			found = info
+			return false
+		}
+		return true
+	})
+	if found == nil {
+		return nil, fmt.Errorf("no identifier found at offset %d", searchpos)
+	}
+	return found, nil
+}
+
+// setTarget sets the object to be renamed and loads
+// the packages that might refer to it.
+func (r *renamer) setTarget(info *sym.Info) error {
+	r.from = info.Ident.Name
+	switch {
+	case info.Universe:
+		return fmt.Errorf("cannot rename predeclared identifier %s", r.from)
+	case info.ReferObj.Kind == ast.Pkg:
+		return fmt.Errorf("cannot rename package name %s", r.from)
+	case r.from == r.to:
+		return fmt.Errorf("%s is already named %s", r.from, r.to)
+	}
+	if field, ok := info.ReferObj.Decl.(*ast.Field); ok && len(field.Names) == 1 && field.Type.Pos().IsValid() && field.Type.Pos() <= field.Names[0].Pos() {
+		// The name of an embedded field is its type name.
+		return fmt.Errorf("cannot rename embedded field %s", r.from)
+	}
+	pos := r.ctxt.FileSet.Position(info.ReferPos)
+	if !inDir(r.root, pos.Filename) {
+		return fmt.Errorf("cannot rename %s: declared outside %s", r.from, r.root)
+	}
+	r.target = identKey{pos.Filename, pos.Offset}
+	r.obj = info.ReferObj
+	if info.Local || !ast.IsExported(r.from) {
+		// Only the declaring package can refer to it.
+		return r.load(filepath.Dir(pos.Filename))
+	}
+	return r.loadModule()
+}
+
+// loadModule loads all the packages in the module, skipping
+// vendor and testdata directories and nested modules.
+func (r *renamer) loadModule() error {
+	return filepath.Walk(r.root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			return nil
+		}
+		if path != r.root {
+			name := fi.Name()
+			if name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+				// Nested module.
+				return filepath.SkipDir
+			}
+		}
+		err = r.load(path)
+		if err != nil && r.skipBroken {
+			r.skipped = append(r.skipped, fmt.Errorf("skipped %s: %v", path, err))
+			return nil
+		}
+		return err
+	})
+}
+
+// collect finds all the references to the object being
+// renamed, and records what every identifier refers to.
+func (r *renamer) collect() error {
+	fset := r.ctxt.FileSet
+	for _, p := range r.pkgs {
+		for _, name := range fileNames(p.pkg) {
+			f := p.pkg.Files[name]
+			for _, imp := range fileImports(f) {
+				if imp.Name != nil && imp.Name.Name == "." {
+					return fmt.Errorf("cannot rename %s: %v: import to . not supported", r.from, fset.Position(imp.Pos()))
+				}
+			}
+			visited := make(map[*ast.Ident]bool)
+			r.ctxt.IterateSyms(f, func(info *sym.Info) bool {
+				visited[info.Ident] = true
+				res := r.resolve(fset, info)
+				r.resolved[identKey{res.pos.Filename, res.pos.Offset}] = res
+				if res.decl == r.target && !r.renamed[info.Ident] {
+					r.renamed[info.Ident] = true
+					r.offsets[name] = append(r.offsets[name], res.pos.Offset)
+					r.files[name] = f
+				}
+				return true
+			})
+			if err := r.checkUnresolved(f, visited); err != nil {
+				return err
+			}
+		}
+	}
+	for _, offsets := range r.offsets {
+		sort.Ints(offsets)
+	}
+	return nil
+}
+
+// checkUnresolved returns an error if f contains an identifier
+// with the old name that go/sym did not resolve, and so might
+// be a reference that would not be renamed. The visited map
+// holds the identifiers that were resolved.
+func (r *renamer) checkUnresolved(f *ast.File, visited map[*ast.Ident]bool) error {
+	var err error
+	ast.Inspect(f, func(n ast.Node) bool {
+		if err != nil || n == f.Name {
+			return false
+		}
+		switch n := n.(type) {
+		case *ast.KeyValueExpr:
+			// Keys in literals of unknown type are not resolved.
+			if id, ok := n.Key.(*ast.Ident); ok && id.Name == r.from && !visited[id] {
+				err = fmt.Errorf("cannot rename %s: %v: cannot tell what composite literal key %s refers to", r.from, r.ctxt.FileSet.Position(id.Pos()), id.Name)
+			}
+		case *ast.Ident:
+			if n.Name == r.from && !visited[n] {
+				err = fmt.Errorf("cannot rename %s: %v: cannot tell what %s refers to", r.from, r.ctxt.FileSet.Position(n.Pos()), n.Name)
+			}
+		case *ast.Field:
+			// The type of an embedded field is not resolved.
+			if len(n.Names) == 0 {
+				if id := anonFieldIdent(n.Type); id != nil && id.Name == r.from {
+					err = fmt.Errorf("cannot rename %s: %v: cannot rename embedded field %s", r.from, r.ctxt.FileSet.Position(id.Pos()), id.Name)
+				}
+			}
+		}
+		return true
+	})
+	return err
+}
+
+// resolve returns what the identifier described by info refers to.
+func (r *renamer) resolve(fset *token.FileSet, info *sym.Info) resolution {
+	res := resolution{
+		name: info.Ident.Name,
+		pos:  fset.Position(info.Ident.Pos()),
+	}
+	if !info.Universe {
+		pos := fset.Position(info.ReferPos)
+		res.decl = identKey{pos.Filename, pos.Offset}
+	}
+	return res
+}
+
+// shift returns the key of the identifier k once
+// the renamed identifiers before it have been renamed.
+func (r *renamer) shift(k identKey) identKey {
+	offsets := r.offsets[k.filename]
+	n := sort.SearchInts(offsets, k.offset)
+	k.offset += n * (len(r.to) - len(r.from))
+	return k
+}
+
+// checkAccess checks that references from other packages
+// remain valid when an exported name becomes unexported.
+func (r *renamer) checkAccess() {
+	if ast.IsExported(r.to) {
+		return
+	}
+	declPkg := r.pkgOf[r.target.filename]
+	for _, res := range r.resolved {
+		if res.decl == r.target && r.pkgOf[res.pos.Filename] != declPkg {
+			r.conflictf(res.pos, "reference from package %s would not be able to refer to %s", r.pkgOf[res.pos.Filename].pkg.Name, r.to)
+		}
+	}
+}
+
+// checkMembers checks that a renamed field or method does
+// not clash with an existing field or method of its type.
+// Duplicate methods and other duplicate declarations
+// are found by verify.
+func (r *renamer) checkMembers() {
+	f := r.pkgOf[r.target.filename].pkg.Files[r.target.filename]
+	pos := r.ctxt.FileSet.Position(types.DeclPos(r.obj))
+	switch decl := r.obj.Decl.(type) {
+	case *ast.FuncDecl:
+		if decl.Recv == nil || len(decl.Recv.List) != 1 {
+			return
+		}
+		recv := anonFieldIdent(decl.Recv.List[0].Type)
+		if recv == nil || recv.Obj == nil {
+			return
+		}
+		if spec, ok := recv.Obj.Decl.(*ast.TypeSpec); ok {
+			if st, ok := spec.Type.(*ast.StructType); ok && hasFieldNamed(st.Fields, r.to) {
+				r.conflictf(pos, "%s already has a field %s", spec.Name.Name, r.to)
+			}
+		}
+	case *ast.Field:
+		owner, spec := fieldOwner(f, decl)
+		var fields *ast.FieldList
+		switch owner := owner.(type) {
+		case *ast.StructType:
+			fields = owner.Fields
+		case *ast.InterfaceType:
+			fields = owner.Methods
+		default:
+			return
+		}
+		if hasFieldNamed(fields, r.to) {
+			r.conflictf(pos, "there is already a field or method named %s", r.to)
+		}
+		if spec != nil && spec.Name.Obj != nil {
+			if methods, ok := spec.Name.Obj.Type.(*ast.Scope); ok && methods.Lookup(r.to) != nil {
+				r.conflictf(pos, "%s already has a method %s", spec.Name.Name, r.to)
+			}
+		}
+	}
+}
+
+// checkInterfaces checks that renaming a method does not stop
+// any type from implementing an interface that it implemented
+// before. Method sets are compared by name only.
+func (r *renamer) checkInterfaces() {
+	if r.obj.Kind != ast.Fun {
+		return
+	}
+	if _, ok := r.obj.Decl.(*ast.Field); !ok {
+		if d, ok := r.obj.Decl.(*ast.FuncDecl); !ok || d.Recv == nil {
+			return
+		}
+	}
+	concrete, ifaces := r.allNamedTypes()
+	for _, c := range concrete {
+		for _, i := range ifaces {
+			m, ok := i.methods[r.from]
+			if !ok || m != r.obj && c.methods[r.from] != r.obj {
+				// Only the renamed method matters.
+				continue
+			}
+			if implements(c, i) {
+				r.conflictf(c.pos, "%s would no longer implement %s", c.name, i.name)
+			}
+		}
+	}
+}
+
+// allNamedTypes returns the concrete types declared in the
+// searched packages, and the interfaces declared in them or
+// in the packages that they import, including error.
+func (r *renamer) allNamedTypes() (concrete, ifaces []*namedType) {
+	for _, p := range r.pkgs {
+		for _, t := range r.namedTypes(p.pkg, "") {
+			if t.iface {
+				ifaces = append(ifaces, t)
+			} else {
+				concrete = append(concrete, t)
+			}
+		}
+	}
+	// Types in the searched packages can also implement
+	// interfaces in the packages that they import.
+	imported := make(map[string]bool)
+	for _, p := range r.pkgs {
+		for _, name := range fileNames(p.pkg) {
+			for _, imp := range fileImports(p.pkg.Files[name]) {
+				path, _ := strconv.Unquote(imp.Path.Value)
+				if imported[path] {
+					continue
+				}
+				imported[path] = true
+				if ipkg, _ := r.ctxt.Import(path, p.dir); ipkg != nil && !r.isSearched(ipkg) {
+					for _, t := range r.namedTypes(ipkg, ipkg.Name+".") {
+						if t.iface {
+							ifaces = append(ifaces, t)
+						}
+					}
+				}
+			}
+		}
+	}
+	// The error interface is not declared anywhere.
+	ifaces = append(ifaces, &namedType{
+		name:    "error",
+		iface:   true,
+		methods: map[string]*ast.Object{"Error": nil},
+	})
+	return concrete, ifaces
+}
+
+// namedType holds a named type and the names of its methods.
+type namedType struct {
+	name    string
+	pos     token.Position
+	iface   bool
+	methods map[string]*ast.Object
+}
+
+// namedTypes returns the types declared at the top level of pkg,
+// with their names prefixed by the given qualifier.
+func (r *renamer) namedTypes(pkg *ast.Package, qual string) []*namedType {
+	var ts []*namedType
+	for _, name := range fileNames(pkg) {
+		for _, decl := range pkg.Files[name].Decls {
+			decl, ok := decl.(*ast.GenDecl)
+			if !ok || decl.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range decl.Specs {
+				spec := spec.(*ast.TypeSpec)
+				if qual != "" && !ast.IsExported(spec.Name.Name) {
+					continue
+				}
+				_, typ := types.ExprType(spec.Name, r.ctxt.TypesImporter(), r.ctxt.FileSet)
+				if typ.Kind != ast.Typ {
+					continue
+				}
+				_, iface := typ.Underlying(true).Node.(*ast.InterfaceType)
+				t := &namedType{
+					name:    qual + spec.Name.Name,
+					pos:     r.ctxt.FileSet.Position(spec.Name.Pos()),
+					iface:   iface,
+					methods: make(map[string]*ast.Object),
+				}
+				typ.Members(context.Background(), -1, func(m types.MemberInfo) bool {
+					if m.Obj.Kind == ast.Fun {
+						t.methods[m.Obj.Name] = m.Obj
+					}
+					return true
+				})
+				ts = append(ts, t)
+			}
+		}
+	}
+	return ts
+}
+
+func (r *renamer) isSearched(pkg *ast.Package) bool {
+	for _, p := range r.pkgs {
+		if p.pkg == pkg {
+			return true
+		}
+	}
+	return false
+}
+
+// implements reports whether c has all the methods of i.
+func implements(c, i *namedType) bool {
+	if len(i.methods) == 0 {
+		return false
+	}
+	for name := range i.methods {
+		if _, ok := c.methods[name]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// verify parses the searched packages again with the identifiers
+// renamed, and checks that every identifier still refers to the
+// same object as before.
+func (r *renamer) verify() error {
+	vctxt := sym.NewContext()
+	var files []*ast.File
+	for _, p := range r.pkgs {
+		pkg := &ast.Package{
+			Name:  p.pkg.Name,
+			Scope: ast.NewScope(parser.Universe),
+			Files: make(map[string]*ast.File),
+		}
+		for _, name := range fileNames(p.pkg) {
+			src, err := r.newSource(name)
+			if err != nil {
+				return err
+			}
+			f, err := parser.ParseFile(vctxt.FileSet, name, src, parser.ParseComments|parser.DeclarationErrors, pkg.Scope, nil)
+			if f == nil {
+				return fmt.Errorf("cannot parse renamed %s: %v", name, err)
+			}
+			if errs, ok := err.(scanner.ErrorList); ok {
+				for _, e := range errs {
+					if strings.HasPrefix(e.Msg, r.to+" redeclared") {
+						// Omit the position of the previous declaration.
+						r.conflictf(e.Pos, "%s", strings.SplitN(e.Msg, "\n", 2)[0])
+					}
+				}
+			}
+			pkg.Files[name] = f
+			files = append(files, f)
+		}
+		if p.path != "" {
+			vctxt.AddPackage(p.path, pkg)
+		}
+	}
+	after := make(map[identKey]resolution)
+	for _, f := range files {
+		vctxt.IterateSyms(f, func(info *sym.Info) bool {
+			res := r.resolve(vctxt.FileSet, info)
+			after[identKey{res.pos.Filename, res.pos.Offset}] = res
+			return true
+		})
+	}
+	target := r.shift(r.target)
+	seen := make(map[identKey]bool)
+	for k, res := range r.resolved {
+		k = r.shift(k)
+		seen[k] = true
+		switch newRes, ok := after[k]; {
+		case !ok:
+			r.conflictf(res.pos, "%s would no longer refer to anything", res.name)
+		case newRes.decl != r.shift(res.decl):
+			r.conflictf(res.pos, "%s would refer to a different object", res.name)
+		}
+	}
+	for k, res := range after {
+		if !seen[k] && res.decl == target {
+			r.conflictf(res.pos, "%s would refer to the renamed object", res.name)
+		}
+	}
+	return nil
+}
+
+// newSource returns the contents of the named file
+// with the identifiers renamed.
+func (r *renamer) newSource(filename string) ([]byte, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	offsets := r.offsets[filename]
+	if len(offsets) == 0 {
+		return data, nil
+	}
+	var buf bytes.Buffer
+	last := 0
+	for _, off := range offsets {
+		if !bytes.HasPrefix(data[off:], []byte(r.from)) {
+			return nil, fmt.Errorf("%s has changed", filename)
+		}
+		buf.Write(data[last:off])
+		buf.WriteString(r.to)
+		last = off + len(r.from)
+	}
+	buf.Write(data[last:])
+	return buf.Bytes(), nil
+}
+
+// fieldOwner returns the struct or interface type in f whose
+// fields or methods include field, and the type spec that
+// declares it, if there is one.
+func fieldOwner(f *ast.File, field *ast.Field) (owner ast.Node, spec *ast.TypeSpec) {
+	var specs []*ast.TypeSpec
+	ast.Inspect(f, func(n ast.Node) bool {
+		if owner != nil {
+			return false
+		}
+		var fields *ast.FieldList
+		switch n := n.(type) {
+		case *ast.TypeSpec:
+			specs = append(specs, n)
+		case *ast.StructType:
+			fields = n.Fields
+		case *ast.InterfaceType:
+			fields = n.Methods
+		}
+		if fields == nil {
+			return true
+		}
+		for _, fl := range fields.List {
+			if fl == field {
+				owner = n
+				break
+			}
+		}
+		return owner == nil
+	})
+	for _, s := range specs {
+		if s.Type == owner {
+			spec = s
+		}
+	}
+	return owner, spec
+}
+
+// hasFieldNamed reports whether fields includes
+// a field or method with the given name.
+func hasFieldNamed(fields *ast.FieldList, name string) bool {
+	for _, field := range fields.List {
+		if len(field.Names) == 0 {
+			if id := anonFieldIdent(field.Type); id != nil && id.Name == name {
+				return true
+			}
+		}
+		for _, id := range field.Names {
+			if id.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// anonFieldIdent returns the identifier naming the
+// type of an embedded field or a method receiver.
+func anonFieldIdent(e ast.Expr) *ast.Ident {
+	switch e := e.(type) {
+	case *ast.Ident:
+		return e
+	case *ast.SelectorExpr:
+		return e.Sel
+	case *ast.StarExpr:
+		return anonFieldIdent(e.X)
+	case *ast.ParenExpr:
+		return anonFieldIdent(e.X)
+	}
+	return nil
+}
+
+// fileImports returns the import specs in f.
+func fileImports(f *ast.File) []*ast.ImportSpec {
+	var imports []*ast.ImportSpec
+	for _, decl := range f.Decls {
+		decl, ok := decl.(*ast.GenDecl)
+		if !ok || decl.Tok != token.IMPORT {
+			continue
+		}
+		for _, spec := range decl.Specs {
+			imports = append(imports, spec.(*ast.ImportSpec))
+		}
+	}
+	return imports
+}
+
+// fileNames returns the names of the files in pkg, sorted.
+func fileNames(pkg *ast.Package) []string {
+	names := make([]string, 0, len(pkg.Files))
+	for name := range pkg.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// inDir reports whether the file is inside dir.
+func inDir(dir, file string) bool {
+	rel, err := filepath.Rel(dir, file)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
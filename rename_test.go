@@ -0,0 +1,197 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rogpeppe/godef/go/sym"
+	"github.com/rogpeppe/godef/internal/testfiles"
+)
+
+const renameModA = `package a
+
+import "fmt"
+
+type T struct {
+	Name string
+}
+
+func (t T) String() string {
+	return fmt.Sprint(t.Name)
+}
+
+func (t T) Inc() {}
+
+func New(name string) T {
+	x := 1
+	y := 2
+	_ = x + y
+	return T{Name: name}
+}
+
+func Count(Items ...string) int {
+	return len(Items)
+}
+`
+
+const renameModB = `package b
+
+import "example.com/m/a"
+
+func Use() string {
+	t := a.New("x")
+	t.Inc()
+	return t.String()
+}
+`
+
+// renameModC holds code that the legacy printer would not
+// reproduce byte for byte.
+const renameModC = `package c
+
+type Named interface{ Name() string }
+
+func Trim(s []int, n Named) []int {
+	_ = n.Name()
+	return s[:len(s):len(s)]
+}
+`
+
+var renameTests = []struct {
+	about string
+	file  string
+	at    string
+	to    string
+	want  map[string]string
+	err   string
+}{{
+	about: "exported function referred to from another package",
+	file:  "a/a.go",
+	at:    "New(name",
+	to:    "Make",
+	want: map[string]string{
+		"a/a.go": strings.Replace(renameModA, "New(", "Make(", 1),
+		"b/b.go": strings.Replace(renameModB, "a.New", "a.Make", 1),
+	},
+}, {
+	about: "method referred to from another package",
+	file:  "b/b.go",
+	at:    "Inc()",
+	to:    "Incr",
+	want: map[string]string{
+		"a/a.go": strings.Replace(renameModA, "Inc()", "Incr()", 1),
+		"b/b.go": strings.Replace(renameModB, "Inc()", "Incr()", 1),
+	},
+}, {
+	about: "local variable",
+	file:  "a/a.go",
+	at:    "x := 1",
+	to:    "z",
+	want: map[string]string{
+		"a/a.go": strings.Replace(strings.Replace(renameModA, "x := 1", "z := 1", 1), "x + y", "z + y", 1),
+	},
+}, {
+	about: "parameter with an exported name",
+	file:  "a/a.go",
+	at:    "Items ...",
+	to:    "Elems",
+	want: map[string]string{
+		"a/a.go": strings.Replace(renameModA, "Items", "Elems", -1),
+	},
+}, {
+	about: "local variable clashing with another",
+	file:  "a/a.go",
+	at:    "x := 1",
+	to:    "y",
+	err:   "y would refer to a different object",
+}, {
+	about: "duplicate method",
+	file:  "a/a.go",
+	at:    "Inc()",
+	to:    "String",
+	err:   "String redeclared in this block",
+}, {
+	about: "method implementing an interface",
+	file:  "a/a.go",
+	at:    "String()",
+	to:    "Str",
+	err:   "T would no longer implement fmt.Stringer",
+}, {
+	about: "unexporting a name used in another package",
+	file:  "a/a.go",
+	at:    "New(name",
+	to:    "newT",
+	err:   "reference from package b would not be able to refer to newT",
+}, {
+	about: "field used as a composite literal key",
+	file:  "a/a.go",
+	at:    "Name string",
+	to:    "Label",
+	want: map[string]string{
+		"a/a.go": strings.Replace(renameModA, "Name", "Label", -1),
+	},
+}, {
+	about: "parameter in code the printer would reformat",
+	file:  "c/c.go",
+	at:    "s []int",
+	to:    "xs",
+	want: map[string]string{
+		"c/c.go": strings.NewReplacer("s []int", "xs []int", "s[:len(s):len(s)]", "xs[:len(xs):len(xs)]").Replace(renameModC),
+	},
+}, {
+	about: "predeclared identifier",
+	file:  "a/a.go",
+	at:    "string {",
+	to:    "str",
+	err:   "cannot rename predeclared identifier string",
+}}
+
+func TestRename(t *testing.T) {
+	for i, test := range renameTests {
+		t.Logf("test %d: %s", i, test.about)
+		files := map[string]string{
+			"go.mod": "module example.com/m\n",
+			"a/a.go": renameModA,
+			"b/b.go": renameModB,
+			"c/c.go": renameModC,
+		}
+		dir := testfiles.Write(t, files)
+		defer os.RemoveAll(dir)
+		changed, err := rename(filepath.Join(dir, test.file), nil, strings.Index(files[test.file], test.at), test.to)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("got error %v; want error containing %q", err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			continue
+		}
+		if len(changed) != len(test.want) {
+			t.Errorf("got %d changed files; want %d", len(changed), len(test.want))
+		}
+		if err := sym.WriteFilesAtomic(changed); err != nil {
+			t.Fatal(err)
+		}
+		for name := range files {
+			if !strings.HasSuffix(name, ".go") {
+				continue
+			}
+			data, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, ok := test.want[name]
+			if !ok {
+				want = files[name]
+			}
+			if string(data) != want {
+				t.Errorf("unexpected contents of %s; got\n%s\nwant\n%s", name, data, want)
+			}
+		}
+	}
+}
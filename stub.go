@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/packages"
+)
+
+// stubMethods returns the source of the given file with stubs added
+// for the methods of the interface named by iface, as for the -q
+// flag, that the receiver lacks. The receiver is of the form
+// "T", "*T", "t T" or "t *T", where T is a type declared in the
+// file's package. Types in the signatures are qualified by the names
+// the file imports their packages as, and imports are added for
+// packages the file does not import yet. The stubs are inserted
+// after the declaration of T if it is in the file, or at the end
+// of the file otherwise. It also returns the names of the
+// methods stubbed, which may be empty.
+func stubMethods(cfg *packages.Config, filename string, src []byte, iface, recv string) ([]byte, []string, error) {
+	recvName, recvPtr, typeName, err := parseReceiver(recv)
+	if err != nil {
+		return nil, nil, err
+	}
+	_, ifaceObj, err := godefQuery(cfg, iface)
+	if err != nil {
+		return nil, nil, err
+	}
+	tn, ok := ifaceObj.(*types.TypeName)
+	if !ok || !types.IsInterface(tn.Type()) {
+		return nil, nil, fmt.Errorf("%s is not an interface type", iface)
+	}
+	it := tn.Type().Underlying().(*types.Interface)
+
+	pkg, err := loadFilePackage(cfg, filename, src)
+	if err != nil {
+		return nil, nil, err
+	}
+	recvObj, ok := pkg.Types.Scope().Lookup(typeName).(*types.TypeName)
+	if !ok {
+		return nil, nil, fmt.Errorf("no type %s in package %s", typeName, pkg.Name)
+	}
+	var recvType types.Type = recvObj.Type()
+	if recvPtr {
+		recvType = types.NewPointer(recvType)
+	}
+
+	qual := importQualifier(filename, src, pkg.PkgPath)
+	needed := make(map[string]bool)
+	tqual := func(p *types.Package) string {
+		name := qual(p.Path(), p.Name())
+		if name != "" {
+			needed[p.Path()] = true
+		}
+		return name
+	}
+	ifaceName := tn.Name()
+	if q := qual(tn.Pkg().Path(), tn.Pkg().Name()); q != "" {
+		ifaceName = q + "." + ifaceName
+	}
+	var stubs bytes.Buffer
+	var names []string
+	for i := 0; i < it.NumMethods(); i++ {
+		m := it.Method(i)
+		// Methods with either kind of receiver cannot be
+		// declared again, and nor can a method with the
+		// same name as a field of T. A promoted field is
+		// hidden by the new method, so that is fine.
+		switch obj, index, _ := types.LookupFieldOrMethod(recvType, true, pkg.Types, m.Name()); obj := obj.(type) {
+		case *types.Func:
+			continue
+		case *types.Var:
+			if len(index) == 1 {
+				return nil, nil, fmt.Errorf("cannot add method %s to %s: it has a field %s", m.Name(), typeName, obj.Name())
+			}
+		}
+		if !m.Exported() && m.Pkg().Path() != pkg.PkgPath {
+			return nil, nil, fmt.Errorf("cannot implement unexported method %s of %s outside package %s", m.Name(), iface, m.Pkg().Path())
+		}
+		names = append(names, m.Name())
+		writeStub(&stubs, m, ifaceName, recvName, recvPtr, typeName, tqual)
+	}
+	if len(names) == 0 {
+		return src, nil, nil
+	}
+
+	// Add the imports, then insert the stubs into the text
+	// and format the result.
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, spec := range f.Imports {
+		if path, err := strconv.Unquote(spec.Path.Value); err == nil {
+			delete(needed, path)
+		}
+	}
+	paths := make([]string, 0, len(needed))
+	for path := range needed {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		astutil.AddImport(fset, f, path)
+	}
+	var buf bytes.Buffer
+	if err := (&printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}).Fprint(&buf, fset, f); err != nil {
+		return nil, nil, err
+	}
+	fset = token.NewFileSet()
+	f, err = parser.ParseFile(fset, filename, buf.Bytes(), parser.ParseComments)
+	if err != nil {
+		return nil, nil, err
+	}
+	at := len(buf.Bytes())
+	if end := typeDeclEnd(f, typeName); end.IsValid() {
+		at = fset.Position(end).Offset
+	}
+	var out bytes.Buffer
+	out.Write(buf.Bytes()[:at])
+	out.WriteString("\n\n")
+	out.Write(stubs.Bytes())
+	out.Write(buf.Bytes()[at:])
+	newSrc, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot format stubs: %v", err)
+	}
+	return newSrc, names, nil
+}
+
+// writeStub writes to w a method with a body that panics,
+// implementing m, a method of the interface ifaceName.
+func writeStub(w *bytes.Buffer, m *types.Func, ifaceName, recvName string, recvPtr bool, typeName string, qual types.Qualifier) {
+	sig := m.Type().(*types.Signature)
+	// A receiver cannot have the same name as a parameter.
+	for _, vars := range []*types.Tuple{sig.Params(), sig.Results()} {
+		for i := 0; i < vars.Len(); i++ {
+			if vars.At(i).Name() == recvName {
+				recvName = ""
+			}
+		}
+	}
+	recv := typeName
+	if recvPtr {
+		recv = "*" + recv
+	}
+	if recvName != "" {
+		recv = recvName + " " + recv
+	}
+	fmt.Fprintf(w, "// %s implements %s.\n", m.Name(), ifaceName)
+	fmt.Fprintf(w, "func (%s) %s", recv, m.Name())
+	types.WriteSignature(w, sig, qual)
+	fmt.Fprintf(w, " {\n\tpanic(\"unimplemented\")\n}\n\n")
+}
+
+// parseReceiver parses a receiver of the form "T",
+// "*T", "t T" or "t *T". If there is no receiver name,
+// the lower case first letter of the type name is used.
+func parseReceiver(recv string) (name string, ptr bool, typeName string, err error) {
+	fields := strings.Fields(recv)
+	switch len(fields) {
+	case 1:
+		typeName = fields[0]
+	case 2:
+		name, typeName = fields[0], fields[1]
+	default:
+		return "", false, "", fmt.Errorf("invalid receiver %q", recv)
+	}
+	if strings.HasPrefix(typeName, "*") {
+		ptr, typeName = true, typeName[1:]
+	}
+	if !token.IsIdentifier(typeName) || name != "" && !token.IsIdentifier(name) {
+		return "", false, "", fmt.Errorf("invalid receiver %q", recv)
+	}
+	if name == "" {
+		r, _ := utf8.DecodeRuneInString(typeName)
+		name = string(unicode.ToLower(r))
+	}
+	return name, ptr, typeName, nil
+}
+
+// typeDeclEnd returns the end of the declaration
+// of the named type in f, or token.NoPos if
+// f does not declare it.
+func typeDeclEnd(f *ast.File, name string) token.Pos {
+	for _, decl := range f.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			if spec.(*ast.TypeSpec).Name.Name == name {
+				return gd.End()
+			}
+		}
+	}
+	return token.NoPos
+}
+
+// loadFilePackage type checks the package containing the given
+// file, whose contents are src, from source. The function bodies
+// in the package are not checked.
+func loadFilePackage(cfg *packages.Config, filename string, src []byte) (*packages.Package, error) {
+	isInputFile := newFileCompare(filename)
+	lcfg := *cfg
+	lcfg.Mode = packages.LoadSyntax
+	lcfg.ParseFile = func(fset *token.FileSet, fname string, filedata []byte) (*ast.File, error) {
+		if isInputFile(fname) && src != nil {
+			filedata = src
+		}
+		file, err := parser.ParseFile(fset, fname, filedata, 0)
+		if file != nil {
+			trimAST(file, token.NoPos)
+		}
+		return file, err
+	}
+	lpkgs, err := packages.Load(&lcfg, "file="+filename)
+	if err != nil {
+		return nil, err
+	}
+	if len(lpkgs) < 1 || lpkgs[0].Types == nil {
+		return nil, fmt.Errorf("no package found containing %s", filename)
+	}
+	return lpkgs[0], nil
+}
+
+// writeStubs writes newSrc, the source of the file with stubs added
+// for the given methods, to out if the source was read from
+// standard input or acme, or back to the file otherwise, printing
+// the name of the file if it was changed.
+func writeStubs(out io.Writer, filename string, newSrc []byte, methods []string) error {
+	if *readStdin || *acmeFlag {
+		_, err := out.Write(newSrc)
+		return err
+	}
+	if len(methods) == 0 {
+		return nil
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filename, newSrc, info.Mode().Perm()); err != nil {
+		return err
+	}
+	fmt.Fprintln(out, filename)
+	return nil
+}
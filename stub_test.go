@@ -0,0 +1,130 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rogpeppe/godef/internal/testfiles"
+	"golang.org/x/tools/go/packages"
+)
+
+var stubFiles = map[string]string{
+	"go.mod": "module example.com/m\n",
+	"a/a.go": `package a
+
+import cc "example.com/m/c"
+
+var _ cc.Key
+
+// T is a type.
+type T struct{}
+
+func (t *T) Close() error { return nil }
+
+func other() {}
+`,
+	"b/b.go": `package b
+
+import (
+	"io"
+
+	"example.com/m/c"
+)
+
+type I interface {
+	Open(name string) (io.Reader, error)
+	Get(t c.Key) c.Value
+	Close() error
+}
+`,
+	"c/c.go": `package c
+
+type Key string
+
+type Value int
+`,
+	"d/d.go": `package d
+
+type T struct{ Read int }
+`,
+}
+
+const stubWant = `package a
+
+import (
+	cc "example.com/m/c"
+	"io"
+)
+
+var _ cc.Key
+
+// T is a type.
+type T struct{}
+
+// Get implements b.I.
+func (*T) Get(t cc.Key) cc.Value {
+	panic("unimplemented")
+}
+
+// Open implements b.I.
+func (t *T) Open(name string) (io.Reader, error) {
+	panic("unimplemented")
+}
+
+func (t *T) Close() error { return nil }
+
+func other() {}
+`
+
+var stubTests = []struct {
+	file    string
+	iface   string
+	recv    string
+	want    string
+	methods []string
+	err     string
+}{{
+	file:    "a/a.go",
+	iface:   "example.com/m/b.I",
+	recv:    "t *T",
+	want:    stubWant,
+	methods: []string{"Get", "Open"},
+}, {
+	file:  "a/a.go",
+	iface: "example.com/m/c.Key",
+	recv:  "T",
+	err:   "is not an interface",
+}, {
+	file:  "d/d.go",
+	iface: "io.ReadWriteCloser",
+	recv:  "*T",
+	err:   "cannot add method Read to T: it has a field Read",
+}}
+
+func TestStubMethods(t *testing.T) {
+	dir := testfiles.Write(t, stubFiles)
+	defer os.RemoveAll(dir)
+	for _, test := range stubTests {
+		filename := filepath.Join(dir, filepath.FromSlash(test.file))
+		cfg := &packages.Config{Dir: filepath.Dir(filename)}
+		newSrc, methods, err := stubMethods(cfg, filename, []byte(stubFiles[test.file]), test.iface, test.recv)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: got error %v; want error containing %q", test.iface, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.iface, err)
+			continue
+		}
+		if got := string(newSrc); got != test.want {
+			t.Errorf("%s: unexpected source; got\n%s\nwant\n%s", test.iface, got, test.want)
+		}
+		if strings.Join(methods, " ") != strings.Join(test.methods, " ") {
+			t.Errorf("%s: got methods %q; want %q", test.iface, methods, test.methods)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"go/types"
+	"path/filepath"
+	"sort"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// superMethods returns the interface methods that are implemented
+// by the method identified at searchpos in the given file. The
+// interfaces searched are those declared in the main module and
+// the packages it imports directly. An interface
+// method is only included if the interface that declares it is
+// implemented by the method's receiver type or a pointer to it.
+func superMethods(cfg *packages.Config, filename string, src []byte, searchpos int) ([]*Object, error) {
+	filename, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	scfg := *cfg
+	if scfg.Dir == "" {
+		scfg.Dir = filepath.Dir(filename)
+	}
+	gcfg := scfg
+	_, _, obj, err := godefPackages(&gcfg, filename, src, searchpos)
+	if err != nil {
+		return nil, err
+	}
+	fn, ok := obj.(*types.Func)
+	if !ok || fn.Type().(*types.Signature).Recv() == nil {
+		return nil, fmt.Errorf("%s is not a method", obj.Name())
+	}
+	recv := fn.Type().(*types.Signature).Recv().Type()
+	if p, ok := recv.(*types.Pointer); ok {
+		recv = p.Elem()
+	}
+	named, ok := recv.(*types.Named)
+	if !ok || types.IsInterface(named) || named.Obj().Pkg() == nil {
+		return nil, fmt.Errorf("%s is not a method of a concrete type", fn.Name())
+	}
+	tname := named.Obj()
+
+	// The method was found by type checking only the file's own
+	// package, so look up the receiver type again among the
+	// module's packages. They are type checked from source, so
+	// that unexported interfaces are seen; without NeedDeps,
+	// the packages they import come from export data.
+	scfg.Mode = packages.NeedName | packages.NeedFiles | packages.NeedImports |
+		packages.NeedTypes | packages.NeedSyntax | packages.NeedTypesInfo
+	scfg.Overlay = nil
+	scfg.ParseFile = nil
+	scfg.Dir = moduleRoot(scfg.Dir)
+	lpkgs, err := packages.Load(&scfg, "./...", "file="+filename)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		recvType types.Type
+		ifaces   []*types.TypeName
+		fset     = lpkgs[0].Fset
+	)
+	packages.Visit(lpkgs, nil, func(p *packages.Package) {
+		// Packages imported only indirectly hold just
+		// the declarations their importers refer to.
+		if p.Types == nil || !p.Types.Complete() {
+			return
+		}
+		scope := p.Types.Scope()
+		if p.PkgPath == tname.Pkg().Path() {
+			if tn, ok := scope.Lookup(tname.Name()).(*types.TypeName); ok {
+				recvType = types.NewPointer(tn.Type())
+			}
+		}
+		for _, name := range scope.Names() {
+			tn, ok := scope.Lookup(name).(*types.TypeName)
+			if !ok || tn.IsAlias() || !types.IsInterface(tn.Type()) {
+				continue
+			}
+			if n, ok := tn.Type().(*types.Named); ok && n.TypeParams().Len() > 0 {
+				// Generic interfaces must be instantiated
+				// before they can be implemented.
+				continue
+			}
+			ifaces = append(ifaces, tn)
+		}
+	})
+	if recvType == nil {
+		return nil, fmt.Errorf("cannot find %s.%s", tname.Pkg().Path(), tname.Name())
+	}
+	var objs []*Object
+	for _, tn := range ifaces {
+		iface := tn.Type().Underlying().(*types.Interface)
+		for i := 0; i < iface.NumExplicitMethods(); i++ {
+			m := iface.ExplicitMethod(i)
+			if m.Name() != fn.Name() || !types.Implements(recvType, iface) {
+				continue
+			}
+			o, err := adaptGoMember(fset, m)
+			if err != nil {
+				return nil, err
+			}
+			o.Name = tn.Name() + "." + m.Name()
+			o.Pkg = tn.Pkg().Path()
+			objs = append(objs, o)
+		}
+	}
+	sort.Slice(objs, func(i, j int) bool {
+		if objs[i].Pkg != objs[j].Pkg {
+			return objs[i].Pkg < objs[j].Pkg
+		}
+		return objs[i].Name < objs[j].Name
+	})
+	return objs, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rogpeppe/godef/internal/testfiles"
+	"golang.org/x/tools/go/packages"
+)
+
+var superFiles = map[string]string{
+	"go.mod": "module example.com/m\n",
+	"a/a.go": `package a
+
+type reader interface {
+	Read(p []byte) (int, error)
+}
+
+type Seq[T any] interface {
+	Read(p []T) (int, error)
+}
+
+type Other interface {
+	Read(p []byte) (int, error)
+	Other()
+}
+`,
+	"b/b.go": `package b
+
+import "io"
+
+type R struct{}
+
+func (r *R) Read(p []byte) (int, error) { return 0, io.EOF }
+
+func (r R) Close() error { return nil }
+
+func (r R) Unique() {}
+`,
+}
+
+var superTests = []struct {
+	at   string
+	want []string
+	err  string
+}{{
+	at:   "Read(p",
+	want: []string{"example.com/m/a.reader.Read", "io.Reader.Read"},
+}, {
+	at:   "Close()",
+	want: []string{"io.Closer.Close"},
+}, {
+	at: "Unique()",
+}, {
+	at:  "R struct",
+	err: "R is not a method",
+}}
+
+func TestSuper(t *testing.T) {
+	dir := testfiles.Write(t, superFiles)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "b", "b.go")
+	src := []byte(superFiles["b/b.go"])
+	for _, test := range superTests {
+		cfg := &packages.Config{Dir: filepath.Dir(filename)}
+		objs, err := superMethods(cfg, filename, src, strings.Index(superFiles["b/b.go"], test.at))
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: got error %v; want error containing %q", test.at, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.at, err)
+			continue
+		}
+		var got []string
+		for _, obj := range objs {
+			got = append(got, obj.Pkg+"."+obj.Name)
+		}
+		if strings.Join(got, " ") != strings.Join(test.want, " ") {
+			t.Errorf("%s: got %q; want %q", test.at, got, test.want)
+		}
+	}
+}
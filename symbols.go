@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/types"
+	"io"
+	"sort"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// symbol holds a package-level declaration or method
+// found by searchSymbols.
+type symbol struct {
+	obj   *Object
+	score int
+}
+
+type symbolJSON struct {
+	Name     string   `json:"name"`
+	Kind     Kind     `json:"kind"`
+	Pkg      string   `json:"pkg"`
+	Position Position `json:"position"`
+}
+
+// searchSymbols returns all the package-level declarations and
+// methods in the main module that fuzzily match pattern, best
+// match first. If deps is true, the module's dependencies
+// are searched too.
+//
+// Packages that fail to load are still searched for whatever
+// declarations could be found, and an error describing each
+// of them is returned in incomplete.
+func searchSymbols(cfg *packages.Config, pattern string, deps bool) (objs []*Object, incomplete []error, err error) {
+	if pattern == "" {
+		return nil, nil, fmt.Errorf("empty symbol pattern")
+	}
+	scfg := *cfg
+	scfg.Mode = packages.NeedName | packages.NeedFiles | packages.NeedTypes
+	scfg.Overlay = nil
+	scfg.ParseFile = nil
+	if scfg.Dir == "" {
+		scfg.Dir = "."
+	}
+	scfg.Dir = moduleRoot(scfg.Dir)
+	query := "./..."
+	if deps {
+		query = "all"
+	}
+	lpkgs, err := packages.Load(&scfg, query)
+	if err != nil {
+		return nil, nil, err
+	}
+	var syms []symbol
+	add := func(pkg *packages.Package, name string, obj types.Object) error {
+		score := fuzzyScore(pattern, name)
+		if score < 0 {
+			return nil
+		}
+		o, err := adaptGoMember(pkg.Fset, obj)
+		if err != nil {
+			return err
+		}
+		o.Name = name
+		o.Pkg = pkg.PkgPath
+		syms = append(syms, symbol{o, score})
+		return nil
+	}
+	for _, pkg := range lpkgs {
+		if err := packageErrors(pkg); err != nil {
+			incomplete = append(incomplete, err)
+		}
+		if pkg.Types == nil {
+			continue
+		}
+		scope := pkg.Types.Scope()
+		for _, name := range scope.Names() {
+			obj := scope.Lookup(name)
+			if err := add(pkg, name, obj); err != nil {
+				return nil, nil, err
+			}
+			tn, ok := obj.(*types.TypeName)
+			if !ok || tn.IsAlias() {
+				continue
+			}
+			for _, m := range typeMethods(tn.Type()) {
+				if err := add(pkg, name+"."+m.Name(), m); err != nil {
+					return nil, nil, err
+				}
+			}
+		}
+	}
+	sort.SliceStable(syms, func(i, j int) bool {
+		si, sj := syms[i], syms[j]
+		if si.score != sj.score {
+			return si.score > sj.score
+		}
+		if si.obj.Name != sj.obj.Name {
+			return si.obj.Name < sj.obj.Name
+		}
+		return si.obj.Pkg < sj.obj.Pkg
+	})
+	objs = make([]*Object, len(syms))
+	for i, s := range syms {
+		objs[i] = s.obj
+	}
+	return objs, incomplete, nil
+}
+
+// typeMethods returns the methods declared on the named type t,
+// or the explicitly declared methods if t is an interface.
+func typeMethods(t types.Type) []*types.Func {
+	var methods []*types.Func
+	if iface, ok := t.Underlying().(*types.Interface); ok {
+		for i := 0; i < iface.NumExplicitMethods(); i++ {
+			methods = append(methods, iface.ExplicitMethod(i))
+		}
+		return methods
+	}
+	if named, ok := t.(*types.Named); ok {
+		for i := 0; i < named.NumMethods(); i++ {
+			methods = append(methods, named.Method(i))
+		}
+	}
+	return methods
+}
+
+// printSymbols prints the symbols found by searchSymbols,
+// one per line, or as a JSON array if the -json flag is set.
+func printSymbols(out io.Writer, objs []*Object) error {
+	if *jsonFlag {
+		syms := make([]symbolJSON, len(objs))
+		for i, obj := range objs {
+			syms[i] = symbolJSON{
+				Name:     obj.Name,
+				Kind:     obj.Kind,
+				Pkg:      obj.Pkg,
+				Position: obj.Position,
+			}
+		}
+		jsonStr, err := json.Marshal(syms)
+		if err != nil {
+			return fmt.Errorf("JSON marshal error: %v", err)
+		}
+		fmt.Fprintf(out, "%s\n", jsonStr)
+		return nil
+	}
+	for _, obj := range objs {
+		fmt.Fprintf(out, "%v\t%s %s.%s\n", obj.Position, obj.Kind, obj.Pkg, obj.Name)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rogpeppe/godef/internal/testfiles"
+	"golang.org/x/tools/go/packages"
+)
+
+var symbolsFiles = map[string]string{
+	"m/go.mod": `module example.com/m
+
+require example.com/r v0.0.0
+
+replace example.com/r => ../r
+`,
+	"m/a/a.go": `package a
+
+import "example.com/r"
+
+type FileSet struct{}
+
+func (fs *FileSet) Offset() int { return 0 }
+
+func FirstSet() {}
+
+var _ = r.FastSort
+`,
+	"m/b/b.go": `package b
+
+func broken() { undefined() }
+
+const FuzzySet = 1
+`,
+	"r/go.mod": "module example.com/r\n",
+	"r/r.go": `package r
+
+func FastSort() {}
+`,
+}
+
+var symbolsTests = []struct {
+	query string
+	deps  bool
+	want  []string
+}{{
+	query: "fs",
+	want: []string{
+		"m/a/a.go:5:6\ttype example.com/m/a.FileSet",
+		"m/a/a.go:9:6\tfunc example.com/m/a.FirstSet",
+		"m/b/b.go:5:7\tconst example.com/m/b.FuzzySet",
+		"m/a/a.go:7:20\tfunc example.com/m/a.FileSet.Offset",
+	},
+}, {
+	query: "Offset",
+	want: []string{
+		"m/a/a.go:7:20\tfunc example.com/m/a.FileSet.Offset",
+	},
+}, {
+	// Only a search of the dependencies finds FastSort.
+	query: "FastSort",
+}, {
+	query: "FastSort",
+	deps:  true,
+	want: []string{
+		"r/r.go:3:6\tfunc example.com/r.FastSort",
+	},
+}}
+
+func TestSearchSymbols(t *testing.T) {
+	dir := testfiles.Write(t, symbolsFiles)
+	defer os.RemoveAll(dir)
+	cfg := &packages.Config{Dir: filepath.Join(dir, "m", "a")}
+	for _, test := range symbolsTests {
+		objs, incomplete, err := searchSymbols(cfg, test.query, test.deps)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.query, err)
+			continue
+		}
+		if len(incomplete) != 1 || !strings.Contains(incomplete[0].Error(), "undefined: undefined") {
+			t.Errorf("%s: got incomplete packages %v; want only b", test.query, incomplete)
+		}
+		var buf bytes.Buffer
+		if err := printSymbols(&buf, objs); err != nil {
+			t.Fatal(err)
+		}
+		want := ""
+		for _, line := range test.want {
+			f := strings.SplitN(line, ":", 2)
+			want += filepath.Join(dir, filepath.FromSlash(f[0])) + ":" + f[1] + "\n"
+		}
+		if got := buf.String(); got != want {
+			t.Errorf("%s: unexpected symbols; got\n%s\nwant\n%s", test.query, got, want)
+		}
+	}
+}
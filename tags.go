@@ -0,0 +1,494 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rogpeppe/godef/go/sym"
+	"golang.org/x/tools/go/packages"
+)
+
+// Tag kinds, as used by Universal Ctags for Go.
+const (
+	packageTag    = 'p'
+	funcTag       = 'f'
+	constTag      = 'c'
+	typeTag       = 't'
+	varTag        = 'v'
+	structTag     = 's'
+	interfaceTag  = 'i'
+	memberTag     = 'm'
+	methodSpecTag = 'n'
+)
+
+// tag holds one entry in a tags file.
+type tag struct {
+	name   string
+	kind   byte
+	line   int    // line number, starting at 1
+	offset int    // byte offset of the start of the line
+	text   string // text of the line
+	col    int    // byte offset of name within text
+
+	// scope holds the kind and name of the type that
+	// declares the tag, such as "struct:T", if any.
+	scope string
+
+	// signature holds the parameters and results
+	// of a function or method.
+	signature string
+}
+
+// tagsFormat describes a tags file format. A tags file is treated
+// as a set of chunks, one for each source file, so that the
+// chunks for unchanged files can be kept in incremental mode.
+type tagsFormat struct {
+	// chunk returns the chunk for the given tags in file.
+	chunk func(file string, tags []tag) string
+
+	// parse splits the contents of a tags file into chunks
+	// keyed by file name.
+	parse func(data []byte) map[string]string
+
+	// join returns the contents of a tags file
+	// holding the given chunks.
+	join func(chunks map[string]string) []byte
+}
+
+var ctagsFormat = &tagsFormat{
+	chunk: ctagsChunk,
+	parse: parseCtags,
+	join:  joinCtags,
+}
+
+var etagsFormat = &tagsFormat{
+	chunk: etagsChunk,
+	parse: parseEtags,
+	join:  joinEtags,
+}
+
+// writeTags writes a tags file in the given format for all
+// the Go files, including tests, in the module containing
+// cfg.Dir. If incremental is true and the tags file already
+// exists, only the files modified since it was written are
+// parsed again, along with the files in the same directories
+// that have methods on types declared in other files, because
+// the scopes of those methods may have changed.
+func writeTags(cfg *packages.Config, tagsFile string, format *tagsFormat, incremental bool) error {
+	tagsFile, err := filepath.Abs(tagsFile)
+	if err != nil {
+		return err
+	}
+	files, err := moduleFiles(cfg)
+	if err != nil {
+		return err
+	}
+	var old map[string]string
+	var written os.FileInfo
+	if incremental {
+		data, err := ioutil.ReadFile(tagsFile)
+		if err == nil {
+			written, err = os.Stat(tagsFile)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		old = format.parse(data)
+	}
+	tagsDir := filepath.Dir(tagsFile)
+	names := make(map[string]string)
+	for _, file := range files {
+		name, err := filepath.Rel(tagsDir, file)
+		if err != nil {
+			name = file
+		}
+		names[file] = filepath.ToSlash(name)
+	}
+	// reuse holds the files whose chunks can be kept,
+	// and changedDirs the directories holding files that
+	// have been added, modified or removed.
+	reuse := make(map[string]bool)
+	changedDirs := make(map[string]bool)
+	for _, file := range files {
+		if _, ok := old[names[file]]; ok {
+			if info, err := os.Stat(file); err == nil && info.ModTime().Before(written.ModTime()) {
+				reuse[file] = true
+				continue
+			}
+		}
+		changedDirs[filepath.Dir(file)] = true
+	}
+	for name := range old {
+		file := filepath.FromSlash(name)
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(tagsDir, file)
+		}
+		if _, ok := names[file]; !ok {
+			changedDirs[filepath.Dir(file)] = true
+		}
+	}
+	kinds := make(scopeKinds)
+	chunks := make(map[string]string)
+	for _, file := range files {
+		name := names[file]
+		if reuse[file] && (!changedDirs[filepath.Dir(file)] || !hasForeignMethods(file)) {
+			chunks[name] = old[name]
+			continue
+		}
+		tags, err := fileTags(file, kinds)
+		if err != nil {
+			return err
+		}
+		chunks[name] = format.chunk(name, tags)
+	}
+	return ioutil.WriteFile(tagsFile, format.join(chunks), 0666)
+}
+
+// moduleFiles returns the Go files, including tests,
+// of all the packages in the module containing cfg.Dir.
+func moduleFiles(cfg *packages.Config) ([]string, error) {
+	mcfg := *cfg
+	mcfg.Mode = packages.NeedName | packages.NeedFiles
+	mcfg.Tests = true
+	mcfg.Overlay = nil
+	mcfg.ParseFile = nil
+	if mcfg.Dir == "" {
+		mcfg.Dir = "."
+	}
+	mcfg.Dir = moduleRoot(mcfg.Dir)
+	lpkgs, err := packages.Load(&mcfg, "./...")
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var files []string
+	for _, lpkg := range lpkgs {
+		for _, file := range lpkg.GoFiles {
+			// Test main packages hold generated
+			// files outside the module.
+			if !seen[file] && inDir(mcfg.Dir, file) {
+				seen[file] = true
+				files = append(files, file)
+			}
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// fileTags returns the tags for the declarations at package level
+// in the given file. The scope of a method is found in kinds,
+// because its receiver type may be declared in another file.
+func fileTags(filename string, kinds scopeKinds) ([]tag, error) {
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, parser.SkipObjectResolution)
+	if f == nil {
+		return nil, err
+	}
+	t := &tagger{
+		fset: fset,
+		src:  src,
+	}
+	t.add(f.Name, packageTag, "", "")
+	for _, decl := range f.Decls {
+		switch decl := decl.(type) {
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					t.typeSpec(spec)
+				case *ast.ValueSpec:
+					kind := byte(varTag)
+					if decl.Tok == token.CONST {
+						kind = constTag
+					}
+					for _, name := range spec.Names {
+						t.add(name, kind, "", "")
+					}
+				}
+			}
+		case *ast.FuncDecl:
+			scope := ""
+			if decl.Recv != nil && len(decl.Recv.List) > 0 {
+				recv := recvTypeName(decl.Recv.List[0].Type)
+				scope = kinds.lookup(filepath.Dir(filename), f.Name.Name, recv) + ":" + recv
+			}
+			t.add(decl.Name, funcTag, scope, t.signature(decl.Type))
+		}
+	}
+	return t.tags, nil
+}
+
+// hasForeignMethods reports whether the given file declares
+// methods on types that are not declared in the same file.
+// It reports true if the file cannot be parsed.
+func hasForeignMethods(filename string) bool {
+	f, _ := parser.ParseFile(token.NewFileSet(), filename, nil, parser.SkipObjectResolution)
+	if f == nil {
+		return true
+	}
+	declared := make(map[string]bool)
+	var recvs []string
+	for _, decl := range f.Decls {
+		switch decl := decl.(type) {
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				if spec, ok := spec.(*ast.TypeSpec); ok {
+					declared[spec.Name.Name] = true
+				}
+			}
+		case *ast.FuncDecl:
+			if decl.Recv != nil && len(decl.Recv.List) > 0 {
+				recvs = append(recvs, recvTypeName(decl.Recv.List[0].Type))
+			}
+		}
+	}
+	for _, recv := range recvs {
+		if !declared[recv] {
+			return true
+		}
+	}
+	return false
+}
+
+type tagger struct {
+	fset *token.FileSet
+	src  []byte
+	tags []tag
+}
+
+func (t *tagger) typeSpec(spec *ast.TypeSpec) {
+	switch typ := spec.Type.(type) {
+	case *ast.StructType:
+		t.add(spec.Name, structTag, "", "")
+		for _, field := range typ.Fields.List {
+			for _, name := range fieldIdents(field) {
+				t.add(name, memberTag, scopeKindNames[structTag]+":"+spec.Name.Name, "")
+			}
+		}
+	case *ast.InterfaceType:
+		t.add(spec.Name, interfaceTag, "", "")
+		for _, field := range typ.Methods.List {
+			ftype, ok := field.Type.(*ast.FuncType)
+			if !ok {
+				// Embedded interface or type constraint.
+				continue
+			}
+			for _, name := range field.Names {
+				t.add(name, methodSpecTag, scopeKindNames[interfaceTag]+":"+spec.Name.Name, t.signature(ftype))
+			}
+		}
+	default:
+		t.add(spec.Name, typeTag, "", "")
+	}
+}
+
+// typeSpecKind returns the tag kind of the type declared by spec.
+func typeSpecKind(spec *ast.TypeSpec) byte {
+	switch spec.Type.(type) {
+	case *ast.StructType:
+		return structTag
+	case *ast.InterfaceType:
+		return interfaceTag
+	}
+	return typeTag
+}
+
+// scopeKindNames holds the names that Universal Ctags
+// gives the kinds of tag that can be a scope.
+var scopeKindNames = map[byte]string{
+	structTag:    "struct",
+	interfaceTag: "interface",
+	typeTag:      "type",
+}
+
+// scopeKinds holds the scope kind, such as "struct", of each type
+// declared at package level, keyed by the directory and name of
+// the package, then by type name.
+type scopeKinds map[string]map[string]string
+
+// lookup returns the scope kind of the type with the given name
+// declared in the package pkgName in dir, or "unknown" if
+// there is no such type.
+func (k scopeKinds) lookup(dir, pkgName, name string) string {
+	key := dir + "\x00" + pkgName
+	kinds, ok := k[key]
+	if !ok {
+		kinds = packageScopeKinds(dir, pkgName)
+		k[key] = kinds
+	}
+	if kind, ok := kinds[name]; ok {
+		return kind
+	}
+	return "unknown"
+}
+
+// packageScopeKinds returns the scope kind of each type declared
+// in the files of package pkgName in dir. Files that cannot be
+// parsed are ignored.
+func packageScopeKinds(dir, pkgName string) map[string]string {
+	kinds := make(map[string]string)
+	pkgs, _ := parser.ParseDir(token.NewFileSet(), dir, nil, parser.SkipObjectResolution)
+	pkg := pkgs[pkgName]
+	if pkg == nil {
+		return kinds
+	}
+	for _, f := range pkg.Files {
+		for _, decl := range f.Decls {
+			decl, ok := decl.(*ast.GenDecl)
+			if !ok || decl.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range decl.Specs {
+				spec := spec.(*ast.TypeSpec)
+				kinds[spec.Name.Name] = scopeKindNames[typeSpecKind(spec)]
+			}
+		}
+	}
+	return kinds
+}
+
+// fieldIdents returns the names declared by a struct field.
+func fieldIdents(field *ast.Field) []*ast.Ident {
+	if len(field.Names) > 0 {
+		return field.Names
+	}
+	if name := embeddedName(field.Type); name != nil {
+		return []*ast.Ident{name}
+	}
+	return nil
+}
+
+// signature returns the parameters and results of a function type.
+func (t *tagger) signature(ftype *ast.FuncType) string {
+	var buf bytes.Buffer
+	printer.Fprint(&buf, t.fset, &ast.FuncType{
+		Params:  ftype.Params,
+		Results: ftype.Results,
+	})
+	return strings.TrimPrefix(buf.String(), "func")
+}
+
+func (t *tagger) add(name *ast.Ident, kind byte, scope, signature string) {
+	if name.Name == "_" {
+		return
+	}
+	pos := t.fset.Position(name.Pos())
+	start := pos.Offset - (pos.Column - 1)
+	end := bytes.IndexByte(t.src[start:], '\n')
+	if end < 0 {
+		end = len(t.src) - start
+	}
+	t.tags = append(t.tags, tag{
+		name:      name.Name,
+		kind:      kind,
+		line:      pos.Line,
+		offset:    start,
+		text:      strings.TrimSuffix(string(t.src[start:start+end]), "\r"),
+		col:       pos.Column - 1,
+		scope:     scope,
+		signature: signature,
+	})
+}
+
+// ctagsHeader holds the pseudo-tags at the start
+// of an extended format ctags file.
+const ctagsHeader = "!_TAG_FILE_FORMAT\t2\t/extended format/\n" +
+	"!_TAG_FILE_SORTED\t1\t/0=unsorted, 1=sorted, 2=foldcase/\n" +
+	"!_TAG_PROGRAM_NAME\tgodef\t//\n"
+
+// ctagsChunk returns a line in extended ctags format for each tag.
+// The address is a search pattern, so the tags stay useful
+// when lines are added to the file, and the line number
+// is given too.
+func ctagsChunk(file string, tags []tag) string {
+	var buf bytes.Buffer
+	for _, t := range tags {
+		pattern := strings.NewReplacer(`\`, `\\`, `/`, `\/`).Replace(t.text)
+		fmt.Fprintf(&buf, "%s\t%s\t/^%s$/;\"\t%c\tline:%d", t.name, file, pattern, t.kind, t.line)
+		if t.scope != "" {
+			fmt.Fprintf(&buf, "\t%s", t.scope)
+		}
+		if t.signature != "" {
+			fmt.Fprintf(&buf, "\tsignature:%s", t.signature)
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.String()
+}
+
+func parseCtags(data []byte) map[string]string {
+	chunks := make(map[string]string)
+	for _, line := range sym.SplitLines(data) {
+		if strings.HasPrefix(line, "!_TAG_") {
+			continue
+		}
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) < 3 {
+			continue
+		}
+		chunks[fields[1]] += line
+	}
+	return chunks
+}
+
+// joinCtags returns the lines of all the chunks sorted by tag name,
+// as required by editors that use binary search.
+func joinCtags(chunks map[string]string) []byte {
+	var lines []string
+	for _, chunk := range chunks {
+		lines = append(lines, sym.SplitLines([]byte(chunk))...)
+	}
+	sort.Strings(lines)
+	return []byte(ctagsHeader + strings.Join(lines, ""))
+}
+
+// etagsChunk returns the section of an Emacs TAGS file for file.
+// Each entry holds the text of the line up to the end of
+// the tag name, followed by the explicit name, line and offset.
+func etagsChunk(file string, tags []tag) string {
+	var buf bytes.Buffer
+	for _, t := range tags {
+		fmt.Fprintf(&buf, "%s\x7f%s\x01%d,%d\n", t.text[:t.col+len(t.name)], t.name, t.line, t.offset)
+	}
+	return fmt.Sprintf("\x0c\n%s,%d\n%s", file, buf.Len(), buf.Bytes())
+}
+
+func parseEtags(data []byte) map[string]string {
+	chunks := make(map[string]string)
+	for _, section := range strings.SplitAfter(string(data), "\x0c\n") {
+		i := strings.IndexByte(section, '\n')
+		j := strings.LastIndexByte(section[:i+1], ',')
+		if i < 0 || j < 0 {
+			continue
+		}
+		chunks[section[:j]] = "\x0c\n" + strings.TrimSuffix(section, "\x0c\n")
+	}
+	return chunks
+}
+
+func joinEtags(chunks map[string]string) []byte {
+	files := make([]string, 0, len(chunks))
+	for file := range chunks {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	var buf bytes.Buffer
+	for _, file := range files {
+		buf.WriteString(chunks[file])
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rogpeppe/godef/internal/testfiles"
+	"golang.org/x/tools/go/packages"
+)
+
+const tagsSrcA = `package a
+
+const C = 1
+
+type T struct {
+	Field int
+}
+
+type I interface {
+	M(x int) error
+}
+
+func (t *T) Method() {}
+
+func F(s string) (int, error) { return 0, nil }
+`
+
+const tagsSrcB = `package a
+
+var V = "/path"
+
+type N int
+
+func (N) Kind() {}
+
+func (T) Other() {}
+`
+
+var tagsWant = `!_TAG_FILE_FORMAT	2	/extended format/
+!_TAG_FILE_SORTED	1	/0=unsorted, 1=sorted, 2=foldcase/
+!_TAG_PROGRAM_NAME	godef	//
+C	a.go	/^const C = 1$/;"	c	line:3
+F	a.go	/^func F(s string) (int, error) { return 0, nil }$/;"	f	line:15	signature:(s string) (int, error)
+Field	a.go	/^	Field int$/;"	m	line:6	struct:T
+I	a.go	/^type I interface {$/;"	i	line:9
+Kind	b.go	/^func (N) Kind() {}$/;"	f	line:7	type:N	signature:()
+M	a.go	/^	M(x int) error$/;"	n	line:10	interface:I	signature:(x int) error
+Method	a.go	/^func (t *T) Method() {}$/;"	f	line:13	struct:T	signature:()
+N	b.go	/^type N int$/;"	t	line:5
+Other	b.go	/^func (T) Other() {}$/;"	f	line:9	struct:T	signature:()
+T	a.go	/^type T struct {$/;"	s	line:5
+V	b.go	/^var V = "\/path"$/;"	v	line:3
+a	a.go	/^package a$/;"	p	line:1
+a	b.go	/^package a$/;"	p	line:1
+`
+
+func writeTagsModule(t *testing.T) string {
+	return testfiles.Write(t, map[string]string{
+		"go.mod": "module example.com/a\n",
+		"a.go":   tagsSrcA,
+		"b.go":   tagsSrcB,
+	})
+}
+
+func TestCtags(t *testing.T) {
+	dir := writeTagsModule(t)
+	defer os.RemoveAll(dir)
+	tagsFile := filepath.Join(dir, "tags")
+	if err := writeTags(&packages.Config{Dir: dir}, tagsFile, ctagsFormat, false); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(tagsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != tagsWant {
+		t.Errorf("unexpected tags; got\n%s\nwant\n%s", data, tagsWant)
+	}
+}
+
+func TestEtags(t *testing.T) {
+	dir := writeTagsModule(t)
+	defer os.RemoveAll(dir)
+	tagsFile := filepath.Join(dir, "TAGS")
+	if err := writeTags(&packages.Config{Dir: dir}, tagsFile, etagsFormat, false); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(tagsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := "package a\x7fa\x011,0\nvar V\x7fV\x013,11\ntype N\x7fN\x015,28\n" +
+		"func (N) Kind\x7fKind\x017,40\nfunc (T) Other\x7fOther\x019,60\n"
+	want := "\x0c\nb.go," + strconv.Itoa(len(entries)) + "\n" + entries
+	if got := string(data); !strings.HasSuffix(got, want) {
+		t.Errorf("unexpected TAGS file; got\n%q\nwant suffix\n%q", got, want)
+	}
+	if got := string(data); !strings.HasPrefix(got, "\x0c\na.go,") {
+		t.Errorf("TAGS file does not start with a.go section; got\n%q", got)
+	}
+}
+
+func TestIncrementalTags(t *testing.T) {
+	dir := writeTagsModule(t)
+	defer os.RemoveAll(dir)
+	for _, format := range []*tagsFormat{ctagsFormat, etagsFormat} {
+		tagsFile := filepath.Join(dir, "tags")
+		cfg := &packages.Config{Dir: dir}
+		if err := writeTags(cfg, tagsFile, format, false); err != nil {
+			t.Fatal(err)
+		}
+		// Change the index entries for a.go, which has not changed,
+		// so that we can tell whether they are kept.
+		data, err := ioutil.ReadFile(tagsFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = []byte(strings.Replace(string(data), "Method", "Kept", -1))
+		if err := ioutil.WriteFile(tagsFile, data, 0666); err != nil {
+			t.Fatal(err)
+		}
+		then := time.Now().Add(-time.Hour)
+		if err := os.Chtimes(filepath.Join(dir, "a.go"), then, then); err != nil {
+			t.Fatal(err)
+		}
+		newSrcB := strings.Replace(tagsSrcB, "V", "W", 1)
+		if err := ioutil.WriteFile(filepath.Join(dir, "b.go"), []byte(newSrcB), 0666); err != nil {
+			t.Fatal(err)
+		}
+		later := time.Now().Add(time.Hour)
+		if err := os.Chtimes(filepath.Join(dir, "b.go"), later, later); err != nil {
+			t.Fatal(err)
+		}
+		if err := writeTags(cfg, tagsFile, format, true); err != nil {
+			t.Fatal(err)
+		}
+		data, err = ioutil.ReadFile(tagsFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := string(data)
+		if !strings.Contains(got, "Kept") || strings.Contains(got, "Method") {
+			t.Errorf("entries for unchanged file were not kept; got\n%s", got)
+		}
+		if !strings.Contains(got, "var W") || strings.Contains(got, "var V") {
+			t.Errorf("entries for changed file were not updated; got\n%s", got)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "b.go"), []byte(tagsSrcB), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestIncrementalTagsScope(t *testing.T) {
+	dir := writeTagsModule(t)
+	defer os.RemoveAll(dir)
+	tagsFile := filepath.Join(dir, "tags")
+	cfg := &packages.Config{Dir: dir}
+	if err := writeTags(cfg, tagsFile, ctagsFormat, false); err != nil {
+		t.Fatal(err)
+	}
+	// Changing T in a.go from a struct to a named type changes
+	// the scope of Other in b.go, which has not changed.
+	then := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "b.go"), then, then); err != nil {
+		t.Fatal(err)
+	}
+	newSrcA := strings.Replace(tagsSrcA, "type T struct {\n\tField int\n}", "type T int", 1)
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.go"), []byte(newSrcA), 0666); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "a.go"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeTags(cfg, tagsFile, ctagsFormat, true); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(tagsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Other\tb.go\t/^func (T) Other() {}$/;\"\tf\tline:9\ttype:T\tsignature:()\n"
+	if got := string(data); !strings.Contains(got, want) {
+		t.Errorf("scope of method in unchanged file not updated; got\n%s\nwant line\n%s", got, want)
+	}
+}
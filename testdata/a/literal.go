@@ -0,0 +1,15 @@
+package a
+
+type Lit struct {
+	Label string //@mark(LitLabel, "Label")
+	Next  *Lit   //@mark(LitNext, "Next")
+}
+
+var Label = "label" //@mark(GlobalLabel, "Label")
+
+var _ = Lit{Label: Label}                 //@godef("Label", LitLabel)
+var _ = []Lit{{Label: "a"}}               //@godef("Label", LitLabel)
+var _ = []*Lit{{Next: nil}}               //@godef("Next", LitNext)
+var _ = map[string]Lit{Label: {}}         //@godef("Label", GlobalLabel)
+var _ = map[string]*Lit{"x": {Label: ""}} //@godef("Label", LitLabel)
+var _ = &Lit{Next: &Lit{Label: "b"}}      //@godef("Label: \"b", LitLabel)
@@ -22,3 +22,10 @@ func Bar() {
 	x.F2      //@godef("F2", S2F2)
 	x.S2.F1   //@godef("F1", S2F1)
 }
+
+/*@
+godefQuery("github.com/rogpeppe/godef/b.S1", S1)
+godefQuery("github.com/rogpeppe/godef/b.S1.F1", S1F1)
+godefQuery("github.com/rogpeppe/godef/b.S1.F2", S2F2)
+godefQuery("github.com/rogpeppe/godef/a.Pos.Sum", PosSum)
+*/
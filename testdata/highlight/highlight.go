@@ -0,0 +1,25 @@
+package highlight
+
+type point struct {
+	x, y int
+}
+
+func highlighting(ps []point) int {
+	total := 0 //@highlight("total", "declaration,write,write,read,read,write")
+	for _, p := range ps {
+		total += p.x
+		total++
+		p.y = total //@highlight("y", "declaration,write")
+	}
+	var v interface{} = total
+	switch v := v.(type) { //@highlight("v :=", "declaration,read,read")
+	case int:
+		total = v
+	case string:
+		_ = v
+	}
+	var q point
+	q.x = 1 //@highlight("q", "declaration,write,address,read")
+	_ = &q
+	return q.x
+}
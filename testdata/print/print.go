@@ -56,14 +56,14 @@ start:
 		){"filename":".*godef.b.b\.go","line":\d+,"column":\d+}\n$`)
 	godefPrint(PrintS1, "type", re`^(|
 		).*godef.b.b\.go:\d+:\d+(\n|
-		)type S1 struct\s*\{\s*F1\s+int[\n;]\s*f2\s+int[\n;]\s*f3\s+S2[\n;]\s*S2\s*\}\n$`)
+		)type S1 struct\s*\{\s*F1\s+int[\n;]\s*f2\s+int[\n;]\s*f3\s+b\.S2[\n;]\s*b\.S2\s*\}\n$`)
 	// this succeeds, but lists no fields which seems wrong
 	_godefPrint(PrintS1, "public", re`^(|
 		).*godef.b.b\.go:\d+:\d+(\n|
-		)type S1 struct\s*\{\s*F1\s+int[\n;]\s*f2\s+int[\n;]\s*f3\s+S2[\n;]\s*S2\s*\}\n$`)
+		)type S1 struct\s*\{\s*F1\s+int[\n;]\s*f2\s+int[\n;]\s*f3\s+b\.S2[\n;]\s*b\.S2\s*\}\n$`)
 	// the following fails, but it lists F1 twice, once as 'F1 string' which is wrong
 	_godefPrint(PrintS1, "all", re`^(|
 		).*godef.b.b\.go:\d+:\d+(\n|
-		)type S1 struct\s*\{\s*F1\s+int[\n;]\s*f2\s+int[\n;]\s*f3\s+S2[\n;]\s*S2\s*\}\n$`)
+		)type S1 struct\s*\{\s*F1\s+int[\n;]\s*f2\s+int[\n;]\s*f3\s+b\.S2[\n;]\s*b\.S2\s*\}\n$`)
 	*/
 }
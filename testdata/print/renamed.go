@@ -0,0 +1,11 @@
+package print
+
+import bee "github.com/rogpeppe/godef/b"
+
+var _ = bee.S1 //@mark(PrintRenamedS1, "S1")
+
+/*@
+godefPrint(PrintRenamedS1, "type", re`^(|
+	).*godef.b.b\.go:\d+:\d+(\n|
+	)type S1 struct\s*\{\s*F1\s+int[\n;]\s*f2\s+int[\n;]\s*f3\s+bee\.S2[\n;]\s*bee\.S2\s*\}\n$`)
+*/
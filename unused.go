@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/rogpeppe/godef/go/ast"
+	"github.com/rogpeppe/godef/go/sym"
+	"github.com/rogpeppe/godef/go/token"
+	"github.com/rogpeppe/godef/go/types"
+)
+
+// unusedIdent describes an exported identifier that
+// is not referred to from outside its own package.
+type unusedIdent struct {
+	// Name holds the name of the identifier, qualified
+	// by its type name for fields and methods.
+	Name     string   `json:"name"`
+	Kind     Kind     `json:"kind"`
+	Pkg      string   `json:"pkg"`
+	Position Position `json:"position"`
+
+	// Internal reports whether the identifier is
+	// referred to from inside its package.
+	Internal bool `json:"internal"`
+}
+
+// unusedDecl holds an exported declaration and
+// what we know about the references to it.
+type unusedDecl struct {
+	ident *unusedIdent
+	pkg   *renamePkg
+
+	// needed reports whether the declaration is referred to from
+	// another package or is a method that is needed to
+	// implement an interface.
+	needed bool
+}
+
+// unusedExported returns the exported functions, types, fields
+// and methods in the module containing dir that are not referred
+// to from outside their package, sorted by position. Methods
+// that implement an interface, and struct fields with tags,
+// which are likely to be used through reflection, are
+// not included. Neither are declarations in test files or
+// main packages.
+//
+// Packages that cannot be loaded, for example because they use
+// syntax that the parser does not understand, are left out, and
+// an error describing each one is returned in skipped. References
+// from those packages are not seen, so some of their dependencies'
+// identifiers may be reported as unused when they are not.
+func unusedExported(dir string) (idents []*unusedIdent, skipped []error, err error) {
+	r := &renamer{
+		ctxt:       sym.NewContext(),
+		root:       moduleRoot(dir),
+		loaded:     make(map[string][]*renamePkg),
+		pkgOf:      make(map[string]*renamePkg),
+		skipBroken: true,
+	}
+	if err := r.loadModule(); err != nil {
+		return nil, nil, err
+	}
+	u := &unusedFinder{
+		r:      r,
+		decls:  make(map[identKey]*unusedDecl),
+		fields: make(map[string][]*unusedDecl),
+	}
+	for _, p := range r.pkgs {
+		u.addDecls(p)
+	}
+	for _, p := range r.pkgs {
+		for _, name := range fileNames(p.pkg) {
+			u.findRefs(p, p.pkg.Files[name])
+		}
+	}
+	u.findImplementations()
+	for _, d := range u.decls {
+		if !d.needed {
+			idents = append(idents, d.ident)
+		}
+	}
+	sort.Slice(idents, func(i, j int) bool {
+		pi, pj := idents[i].Position, idents[j].Position
+		if pi.Filename != pj.Filename {
+			return pi.Filename < pj.Filename
+		}
+		if pi.Line != pj.Line {
+			return pi.Line < pj.Line
+		}
+		return pi.Column < pj.Column
+	})
+	return idents, r.skipped, nil
+}
+
+type unusedFinder struct {
+	r *renamer
+
+	// decls holds the exported declarations, keyed by the
+	// position of their names.
+	decls map[identKey]*unusedDecl
+
+	// fields holds the exported fields by name, for composite
+	// literal keys that IterateSyms cannot resolve because
+	// the type of the literal is unknown.
+	fields map[string][]*unusedDecl
+}
+
+// addDecls adds the exported declarations in p.
+func (u *unusedFinder) addDecls(p *renamePkg) {
+	if p.path == "" || p.pkg.Name == "main" {
+		return
+	}
+	for _, name := range fileNames(p.pkg) {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		for _, decl := range p.pkg.Files[name].Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				if decl.Recv == nil {
+					u.add(p, decl.Name, FuncKind, "")
+				} else if len(decl.Recv.List) == 1 {
+					if recv := anonFieldIdent(decl.Recv.List[0].Type); recv != nil && ast.IsExported(recv.Name) {
+						u.add(p, decl.Name, MethodKind, recv.Name)
+					}
+				}
+			case *ast.GenDecl:
+				if decl.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range decl.Specs {
+					u.typeSpec(p, spec.(*ast.TypeSpec))
+				}
+			}
+		}
+	}
+}
+
+func (u *unusedFinder) typeSpec(p *renamePkg, spec *ast.TypeSpec) {
+	if !u.add(p, spec.Name, TypeKind, "") {
+		return
+	}
+	switch t := spec.Type.(type) {
+	case *ast.StructType:
+		for _, field := range t.Fields.List {
+			if field.Tag != nil {
+				continue
+			}
+			for _, id := range field.Names {
+				if u.add(p, id, FieldKind, spec.Name.Name) {
+					d := u.decls[u.key(id.Pos())]
+					u.fields[id.Name] = append(u.fields[id.Name], d)
+				}
+			}
+		}
+	case *ast.InterfaceType:
+		for _, field := range t.Methods.List {
+			for _, id := range field.Names {
+				u.add(p, id, MethodKind, spec.Name.Name)
+			}
+		}
+	}
+}
+
+// add adds the declaration of id if it is exported,
+// and reports whether it was added.
+func (u *unusedFinder) add(p *renamePkg, id *ast.Ident, kind Kind, typeName string) bool {
+	if !ast.IsExported(id.Name) {
+		return false
+	}
+	name := id.Name
+	if typeName != "" {
+		name = typeName + "." + name
+	}
+	pos := u.r.ctxt.FileSet.Position(id.Pos())
+	u.decls[u.key(id.Pos())] = &unusedDecl{
+		ident: &unusedIdent{
+			Name: name,
+			Kind: kind,
+			Pkg:  p.path,
+			Position: Position{
+				Filename: pos.Filename,
+				Line:     pos.Line,
+				Column:   pos.Column,
+			},
+		},
+		pkg: p,
+	}
+	return true
+}
+
+func (u *unusedFinder) key(pos token.Pos) identKey {
+	p := u.r.ctxt.FileSet.Position(pos)
+	return identKey{p.Filename, p.Offset}
+}
+
+// findRefs records the references in f, which is in p.
+func (u *unusedFinder) findRefs(p *renamePkg, f *ast.File) {
+	resolved := make(map[*ast.Ident]bool)
+	u.r.ctxt.IterateSyms(f, func(info *sym.Info) bool {
+		resolved[info.Ident] = true
+		if info.Pos == info.ReferPos {
+			// The declaration itself.
+			return true
+		}
+		if d := u.decls[u.key(info.ReferPos)]; d != nil {
+			u.addRef(p, d)
+		}
+		return true
+	})
+	ast.Inspect(f, func(n ast.Node) bool {
+		lit, ok := n.(*ast.CompositeLit)
+		if !ok {
+			return true
+		}
+		for _, elt := range lit.Elts {
+			kv, ok := elt.(*ast.KeyValueExpr)
+			if !ok {
+				continue
+			}
+			if key, ok := kv.Key.(*ast.Ident); ok && !resolved[key] {
+				// We cannot tell which field the key refers
+				// to, so count it as a reference to all of
+				// the fields with that name.
+				for _, d := range u.fields[key.Name] {
+					u.addRef(p, d)
+				}
+			}
+		}
+		return true
+	})
+}
+
+// addRef records a reference from p to d. References from the
+// external test package in the same directory as d's package
+// count as internal too.
+func (u *unusedFinder) addRef(p *renamePkg, d *unusedDecl) {
+	if p == d.pkg || p.path == "" && p.dir == d.pkg.dir {
+		d.ident.Internal = true
+	} else {
+		d.needed = true
+	}
+}
+
+// findImplementations marks the methods that are
+// needed to implement an interface.
+func (u *unusedFinder) findImplementations() {
+	concrete, ifaces := u.r.allNamedTypes()
+	for _, c := range concrete {
+		for _, i := range ifaces {
+			if !implements(c, i) {
+				continue
+			}
+			for name := range i.methods {
+				if d := u.decls[u.key(types.DeclPos(c.methods[name]))]; d != nil {
+					d.needed = true
+				}
+			}
+		}
+	}
+}
+
+// printUnused prints the unused identifiers, one per line,
+// or as a JSON list if the -json flag is given.
+func printUnused(out io.Writer, idents []*unusedIdent) error {
+	if *jsonFlag {
+		if idents == nil {
+			idents = []*unusedIdent{}
+		}
+		jsonStr, err := json.Marshal(idents)
+		if err != nil {
+			return fmt.Errorf("JSON marshal error: %v", err)
+		}
+		fmt.Fprintf(out, "%s\n", jsonStr)
+		return nil
+	}
+	for _, id := range idents {
+		pos := id.Position
+		used := "not used"
+		if id.Internal {
+			used = "only used in its package"
+		}
+		fmt.Fprintf(out, "%s:%d:%d: %s %s is %s\n", pos.Filename, pos.Line, pos.Column, id.Kind, id.Name, used)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rogpeppe/godef/internal/testfiles"
+)
+
+var unusedFiles = map[string]string{
+	"go.mod": "module example.com/m\n",
+	"a/a.go": `package a
+
+import "fmt"
+
+type T struct {
+	Name   string
+	Count  int
+	Hidden int
+	Tagged int ` + "`json:\"tagged\"`" + `
+}
+
+func (t T) String() string {
+	return fmt.Sprint(t.Name, t.Hidden)
+}
+
+func (t T) Unused() {}
+
+func New() T {
+	return T{Name: "x"}
+}
+
+func Helper() {}
+
+func Internal() {}
+
+func use() {
+	Internal()
+}
+
+type U struct {
+	Name string
+}
+
+func XTestOnly() {}
+`,
+	"a/a_test.go": `package a
+
+func TestOnly() {}
+`,
+	"a/x_test.go": `package a_test
+
+import "example.com/m/a"
+
+var _ = a.XTestOnly
+`,
+	"b/b.go": `package b
+
+import "example.com/m/a"
+
+func Use() string {
+	t := a.New()
+	t = a.T{Name: "y"}
+	t.Count++
+	return t.String()
+}
+`,
+	"g/g.go": `package g
+
+func Map[T any](xs []T, f func(T) T) []T {
+	return xs
+}
+`,
+	"cmd/c/main.go": `package main
+
+func Main() {}
+
+func main() {}
+`,
+}
+
+// unusedTests holds the exported identifiers in unusedFiles
+// and how -unused reports them, if at all.
+var unusedTests = []struct {
+	name string
+	want string
+}{
+	{"T", ""},
+	{"T.Name", ""},
+	{"T.Count", ""},
+	{"T.Hidden", "a/a.go:8:2: field T.Hidden is only used in its package"},
+	// Fields with tags may be used by reflection.
+	{"T.Tagged", ""},
+	// Methods may be used to implement interfaces.
+	{"T.String", ""},
+	{"T.Unused", "a/a.go:16:12: method T.Unused is not used"},
+	{"New", ""},
+	{"Helper", "a/a.go:22:6: func Helper is not used"},
+	{"Internal", "a/a.go:24:6: func Internal is only used in its package"},
+	{"U", "a/a.go:30:6: type U is not used"},
+	{"U.Name", "a/a.go:31:2: field U.Name is not used"},
+	// The package's external tests are part of the package.
+	{"XTestOnly", "a/a.go:34:6: func XTestOnly is only used in its package"},
+	// Declarations in test files and main packages are ignored.
+	{"TestOnly", ""},
+	{"Main", ""},
+	{"Use", "b/b.go:5:6: func Use is not used"},
+}
+
+func TestUnused(t *testing.T) {
+	dir := testfiles.Write(t, unusedFiles)
+	defer os.RemoveAll(dir)
+	idents, skipped, err := unusedExported(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(skipped) != 1 || !strings.HasPrefix(skipped[0].Error(), "skipped "+filepath.Join(dir, "g")+": ") {
+		t.Errorf("got skipped packages %v; want only g", skipped)
+	}
+	got := make(map[string]string)
+	for _, id := range idents {
+		var buf bytes.Buffer
+		if err := printUnused(&buf, []*unusedIdent{id}); err != nil {
+			t.Fatal(err)
+		}
+		rel, err := filepath.Rel(dir, id.Position.Filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		line := strings.TrimSuffix(buf.String(), "\n")
+		got[id.Name] = filepath.ToSlash(rel) + strings.TrimPrefix(line, id.Position.Filename)
+	}
+	// The identifiers are reported in source order,
+	// which is the order of the tests.
+	var order, wantOrder []string
+	for _, id := range idents {
+		order = append(order, id.Name)
+	}
+	for _, test := range unusedTests {
+		if got[test.name] != test.want {
+			t.Errorf("%s: got %q; want %q", test.name, got[test.name], test.want)
+		}
+		if test.want != "" {
+			wantOrder = append(wantOrder, test.name)
+		}
+		delete(got, test.name)
+	}
+	for name, line := range got {
+		t.Errorf("%s: unexpected report %q", name, line)
+	}
+	if strings.Join(order, " ") != strings.Join(wantOrder, " ") {
+		t.Errorf("got order %q; want %q", order, wantOrder)
+	}
+}
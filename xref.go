@@ -0,0 +1,719 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/printer"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/packages"
+)
+
+// xrefIndex holds the packages of a module, type checked from
+// source, and the references to the objects they declare. It
+// renders the module's source as a site of cross-referenced HTML
+// pages. Page paths are relative to the root of the site, and
+// pages link to each other with relative URLs, so that the
+// site can be browsed from a file system as well as served.
+//
+// The pages are:
+//
+//	index.html          the packages in the module
+//	pkg/DIR/index.html  the files and declarations in a package
+//	src/FILE.html       the source of a file in the module
+//	refs/FILE.html      the references to the objects declared in a file
+//	ext/PATH.html       the source of a file outside the module
+//
+// where DIR and FILE are the slash-separated paths of a package
+// directory and a file relative to the module root, and PATH is
+// the absolute path of a file declaring an object that the module
+// refers to, such as a standard library file.
+type xrefIndex struct {
+	root string
+	fset *token.FileSet
+
+	// files holds the module's Go files, keyed by their
+	// slash-separated paths relative to root.
+	files map[string]*xrefFile
+
+	// byName holds the same files keyed by filename.
+	byName map[string]*xrefFile
+
+	// ext maps the page paths of files outside
+	// the module to their filenames.
+	ext map[string]string
+
+	// refs holds the references to objects,
+	// keyed by the positions of their declarations.
+	refs map[xrefPos][]xrefRef
+}
+
+// xrefFile holds a Go file in the module.
+type xrefFile struct {
+	rel  string
+	src  []byte
+	file *ast.File
+	pkg  *packages.Package
+}
+
+// xrefPos holds the position of a declaration. Lines and columns
+// are used rather than offsets because the positions of objects
+// loaded from export data do not hold offsets.
+type xrefPos struct {
+	filename     string
+	line, column int
+}
+
+// xrefRef holds a reference to an object.
+type xrefRef struct {
+	file         *xrefFile
+	line, column int
+	kind         refKind
+}
+
+// buildXref loads and indexes all the packages in
+// the module containing dir, including their tests.
+func buildXref(cfg *packages.Config, dir string) (*xrefIndex, error) {
+	xcfg := *cfg
+	xcfg.Mode = packages.LoadSyntax
+	xcfg.Dir = moduleRoot(dir)
+	xcfg.Tests = true
+	lpkgs, err := packages.Load(&xcfg, "./...")
+	if err != nil {
+		return nil, err
+	}
+	if len(lpkgs) == 0 {
+		return nil, fmt.Errorf("no packages found in %s", xcfg.Dir)
+	}
+	idx := &xrefIndex{
+		root:   xcfg.Dir,
+		fset:   lpkgs[0].Fset,
+		files:  make(map[string]*xrefFile),
+		byName: make(map[string]*xrefFile),
+		ext:    make(map[string]string),
+		refs:   make(map[xrefPos][]xrefRef),
+	}
+	// The files of a package with tests are loaded twice: in
+	// the package itself and in the variant of it compiled for
+	// its tests, which also holds its _test.go files. Index each
+	// file once, preferring the test variant, so that references
+	// from the tests are seen.
+	sort.SliceStable(lpkgs, func(i, j int) bool {
+		return isTestVariant(lpkgs[i]) && !isTestVariant(lpkgs[j])
+	})
+	for _, pkg := range lpkgs {
+		for _, f := range pkg.Syntax {
+			filename := idx.fset.Position(f.Package).Filename
+			if idx.byName[filename] != nil {
+				continue
+			}
+			rel, err := filepath.Rel(idx.root, filename)
+			if err != nil || strings.HasPrefix(rel, "..") {
+				// Generated by cgo, perhaps.
+				continue
+			}
+			src, err := ioutil.ReadFile(filename)
+			if err != nil {
+				return nil, err
+			}
+			xf := &xrefFile{
+				rel:  filepath.ToSlash(rel),
+				src:  src,
+				file: f,
+				pkg:  pkg,
+			}
+			idx.files[xf.rel] = xf
+			idx.byName[filename] = xf
+		}
+	}
+	for _, rel := range idx.fileNames() {
+		idx.addRefs(idx.files[rel])
+	}
+	return idx, nil
+}
+
+// isTestVariant reports whether pkg is the variant of a
+// package that includes the package's _test.go files.
+func isTestVariant(pkg *packages.Package) bool {
+	return pkg.ID == pkg.PkgPath+" ["+pkg.PkgPath+".test]"
+}
+
+// addRefs records the references in xf.
+func (idx *xrefIndex) addRefs(xf *xrefFile) {
+	info := xf.pkg.TypesInfo
+	inspectIdents(xf.file, func(id *ast.Ident, path []ast.Node) {
+		obj := info.ObjectOf(id)
+		if obj == nil || info.Defs[id] != nil {
+			return
+		}
+		decl, ok := idx.declPos(obj)
+		if !ok {
+			return
+		}
+		if idx.byName[decl.filename] == nil {
+			idx.ext[extPage(decl.filename)] = decl.filename
+		}
+		pos := idx.fset.Position(id.Pos())
+		idx.refs[decl] = append(idx.refs[decl], xrefRef{
+			file:   xf,
+			line:   pos.Line,
+			column: pos.Column,
+			kind:   classifyRef(info, id, path),
+		})
+	})
+}
+
+// declPos returns the position of the declaration of obj,
+// and reports whether it has one.
+func (idx *xrefIndex) declPos(obj types.Object) (xrefPos, bool) {
+	obj = originObj(obj)
+	if !obj.Pos().IsValid() {
+		return xrefPos{}, false
+	}
+	pos := idx.fset.Position(obj.Pos())
+	if pos.Filename == "" {
+		return xrefPos{}, false
+	}
+	return xrefPos{cleanFilename(pos.Filename), pos.Line, pos.Column}, true
+}
+
+func srcPage(rel string) string {
+	return "src/" + rel + ".html"
+}
+
+func refsPage(rel string) string {
+	return "refs/" + rel + ".html"
+}
+
+func pkgPage(dir string) string {
+	if dir == "." {
+		return "pkg/index.html"
+	}
+	return "pkg/" + dir + "/index.html"
+}
+
+func extPage(filename string) string {
+	return "ext/" + strings.TrimPrefix(filepath.ToSlash(filename), "/") + ".html"
+}
+
+// relLink returns a link from the page at path from
+// to the page at path to.
+func relLink(from, to string) string {
+	return strings.Repeat("../", strings.Count(from, "/")) + to
+}
+
+// declAnchor returns the name of the anchor for the
+// declaration at the given line and column in a
+// source or references page.
+func declAnchor(line, column int) string {
+	return fmt.Sprintf("L%dC%d", line, column)
+}
+
+// pages returns the paths of all the pages in the site.
+func (idx *xrefIndex) pages() []string {
+	pages := []string{"index.html"}
+	for _, dir := range idx.pkgDirs() {
+		pages = append(pages, pkgPage(dir))
+	}
+	for _, rel := range idx.fileNames() {
+		pages = append(pages, srcPage(rel), refsPage(rel))
+	}
+	var ext []string
+	for page := range idx.ext {
+		ext = append(ext, page)
+	}
+	sort.Strings(ext)
+	return append(pages, ext...)
+}
+
+// fileNames returns the paths of the
+// module's files relative to its root, sorted.
+func (idx *xrefIndex) fileNames() []string {
+	names := make([]string, 0, len(idx.files))
+	for rel := range idx.files {
+		names = append(names, rel)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// pkgDirs returns the directories of the module's
+// packages relative to its root, sorted.
+func (idx *xrefIndex) pkgDirs() []string {
+	var dirs []string
+	seen := make(map[string]bool)
+	for rel := range idx.files {
+		dir := pathpkg.Dir(rel)
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// pkgFiles returns the module's files in the
+// package in dir, sorted.
+func (idx *xrefIndex) pkgFiles(dir string) []*xrefFile {
+	var files []*xrefFile
+	for _, rel := range idx.fileNames() {
+		if pathpkg.Dir(rel) == dir {
+			files = append(files, idx.files[rel])
+		}
+	}
+	return files
+}
+
+// dirPackage returns the package of the given files in a
+// directory, ignoring any external test package, which
+// holds only some of them.
+func dirPackage(files []*xrefFile) *packages.Package {
+	for _, xf := range files {
+		if !strings.HasSuffix(xf.pkg.Name, "_test") {
+			return xf.pkg
+		}
+	}
+	return files[0].pkg
+}
+
+// page renders the page with the given path. It returns an
+// error satisfying os.IsNotExist if there is no such page.
+func (idx *xrefIndex) page(page string) ([]byte, error) {
+	if page == "index.html" {
+		return idx.renderIndex(), nil
+	}
+	if strings.HasSuffix(page, ".html") {
+		rel := strings.TrimSuffix(page, ".html")
+		switch {
+		case strings.HasPrefix(rel, "src/"):
+			if xf := idx.files[strings.TrimPrefix(rel, "src/")]; xf != nil {
+				return idx.renderSource(page, xf), nil
+			}
+		case strings.HasPrefix(rel, "pkg/"):
+			for _, dir := range idx.pkgDirs() {
+				if pkgPage(dir) == page {
+					return idx.renderPackage(page, idx.pkgFiles(dir)), nil
+				}
+			}
+		case strings.HasPrefix(rel, "refs/"):
+			if xf := idx.files[strings.TrimPrefix(rel, "refs/")]; xf != nil {
+				return idx.renderRefs(page, xf), nil
+			}
+		case strings.HasPrefix(rel, "ext/"):
+			if filename, ok := idx.ext[page]; ok {
+				src, err := ioutil.ReadFile(filename)
+				if err != nil {
+					return nil, err
+				}
+				return idx.renderExt(page, filename, src), nil
+			}
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
+// ServeHTTP implements http.Handler by serving the pages of
+// the site, with the index at the root.
+func (idx *xrefIndex) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	page := strings.TrimPrefix(pathpkg.Clean(req.URL.Path), "/")
+	if page == "" {
+		page = "index.html"
+	}
+	data, err := idx.page(page)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.NotFound(w, req)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(data)
+}
+
+const xrefStyle = `
+body { font-family: sans-serif; margin: 1em 2em; }
+pre { font-family: monospace; line-height: 1.3; }
+a { color: inherit; text-decoration: none; }
+a:hover { text-decoration: underline; }
+.ln { color: #999; display: inline-block; width: 5ch; text-align: right; margin-right: 1ch; user-select: none; }
+.k { color: #00007f; font-weight: bold; }
+.c { color: #007f00; }
+.s { color: #7f0000; }
+.n { color: #7f007f; }
+.id { color: #000; border-bottom: 1px dotted #bbb; }
+.decl { font-weight: bold; }
+.nav { font-size: small; }
+:target { background: #ffffa0; }
+`
+
+// writeHeader writes the start of the page with the given path
+// and title, with navigation links to the given pages.
+func writeHeader(buf *bytes.Buffer, page, title string, nav ...string) {
+	fmt.Fprintf(buf, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n<style>%s</style>\n</head>\n<body>\n", html.EscapeString(title), xrefStyle)
+	fmt.Fprintf(buf, "<p class=\"nav\"><a href=\"%s\">index</a>", relLink(page, "index.html"))
+	for i := 0; i+1 < len(nav); i += 2 {
+		fmt.Fprintf(buf, " · <a href=\"%s\">%s</a>", html.EscapeString(relLink(page, nav[i+1])), html.EscapeString(nav[i]))
+	}
+	fmt.Fprintf(buf, "</p>\n<h1>%s</h1>\n", html.EscapeString(title))
+}
+
+func writeFooter(buf *bytes.Buffer) {
+	buf.WriteString("</body>\n</html>\n")
+}
+
+// renderIndex renders the index page,
+// listing the packages in the module.
+func (idx *xrefIndex) renderIndex() []byte {
+	var buf bytes.Buffer
+	writeHeader(&buf, "index.html", idx.root)
+	buf.WriteString("<ul>\n")
+	for _, dir := range idx.pkgDirs() {
+		pkg := dirPackage(idx.pkgFiles(dir))
+		fmt.Fprintf(&buf, "<li><a href=\"%s\">%s</a> (package %s)</li>\n", html.EscapeString(pkgPage(dir)), html.EscapeString(pkg.PkgPath), html.EscapeString(pkg.Name))
+	}
+	buf.WriteString("</ul>\n")
+	writeFooter(&buf)
+	return buf.Bytes()
+}
+
+// renderPackage renders the index page for the package
+// made up of the given files, listing the files and
+// the package-level declarations in them.
+func (idx *xrefIndex) renderPackage(page string, files []*xrefFile) []byte {
+	pkg := dirPackage(files)
+	var buf bytes.Buffer
+	writeHeader(&buf, page, "package "+pkg.Name)
+	fmt.Fprintf(&buf, "<p>import \"%s\"</p>\n<h2>Files</h2>\n<ul>\n", html.EscapeString(pkg.PkgPath))
+	for _, xf := range files {
+		fmt.Fprintf(&buf, "<li><a href=\"%s\">%s</a> (<a href=\"%s\">references</a>)</li>\n", html.EscapeString(relLink(page, srcPage(xf.rel))), html.EscapeString(pathpkg.Base(xf.rel)), html.EscapeString(relLink(page, refsPage(xf.rel))))
+	}
+	buf.WriteString("</ul>\n<h2>Declarations</h2>\n<ul>\n")
+	scope := pkg.Types.Scope()
+	for _, name := range scope.Names() {
+		decl, ok := idx.declPos(scope.Lookup(name))
+		if !ok || idx.byName[decl.filename] == nil {
+			continue
+		}
+		fmt.Fprintf(&buf, "<li><a href=\"%s#%s\">%s</a></li>\n", html.EscapeString(relLink(page, idx.declPage(decl.filename))), declAnchor(decl.line, decl.column), html.EscapeString(name))
+	}
+	buf.WriteString("</ul>\n")
+	writeFooter(&buf)
+	return buf.Bytes()
+}
+
+// xrefLink holds the link, hover text and, for a
+// declaration, the anchor name for an identifier.
+type xrefLink struct {
+	href, title, anchor string
+}
+
+// renderSource renders the page for the source of xf. Each
+// identifier links to the declaration of the object it refers to,
+// and each declaration links to the references to the object.
+// Hovering over an identifier shows the object and its type.
+func (idx *xrefIndex) renderSource(page string, xf *xrefFile) []byte {
+	info := xf.pkg.TypesInfo
+	qual := func(p *types.Package) string {
+		if p == xf.pkg.Types {
+			return ""
+		}
+		return p.Name()
+	}
+	links := make(map[int]xrefLink)
+	inspectIdents(xf.file, func(id *ast.Ident, _ []ast.Node) {
+		obj := info.ObjectOf(id)
+		if obj == nil {
+			return
+		}
+		pos := idx.fset.Position(id.Pos())
+		link := xrefLink{
+			title: types.ObjectString(obj, qual),
+		}
+		if info.Defs[id] != nil {
+			if id.Name != "_" {
+				link.anchor = declAnchor(pos.Line, pos.Column)
+				link.href = relLink(page, refsPage(xf.rel)) + "#" + link.anchor
+			}
+		} else if decl, ok := idx.declPos(obj); ok {
+			link.href = relLink(page, idx.declLink(decl))
+		}
+		links[pos.Offset] = link
+	})
+	var buf bytes.Buffer
+	writeHeader(&buf, page, xf.rel, "package "+xf.pkg.Name, pkgPage(pathpkg.Dir(xf.rel)), "references", refsPage(xf.rel))
+	writeSource(&buf, xf.src, links)
+	writeFooter(&buf)
+	return buf.Bytes()
+}
+
+// declLink returns the path of the source page showing
+// the declaration at decl, with the fragment identifying it.
+// Declarations in the module have anchors of their own;
+// those outside it are identified by line.
+func (idx *xrefIndex) declLink(decl xrefPos) string {
+	if idx.byName[decl.filename] != nil {
+		return idx.declPage(decl.filename) + "#" + declAnchor(decl.line, decl.column)
+	}
+	return idx.declPage(decl.filename) + fmt.Sprintf("#L%d", decl.line)
+}
+
+// declPage returns the path of the source page
+// for the given file.
+func (idx *xrefIndex) declPage(filename string) string {
+	if xf := idx.byName[filename]; xf != nil {
+		return srcPage(xf.rel)
+	}
+	return extPage(filename)
+}
+
+// renderExt renders the page for the source of a file
+// outside the module, without cross-references.
+func (idx *xrefIndex) renderExt(page, filename string, src []byte) []byte {
+	var buf bytes.Buffer
+	writeHeader(&buf, page, filename)
+	writeSource(&buf, src, nil)
+	writeFooter(&buf)
+	return buf.Bytes()
+}
+
+// renderRefs renders the page listing the references
+// to each of the objects declared in xf, with the
+// declaration of each printed by go/printer.
+func (idx *xrefIndex) renderRefs(page string, xf *xrefFile) []byte {
+	info := xf.pkg.TypesInfo
+	qual := func(p *types.Package) string {
+		if p == xf.pkg.Types {
+			return ""
+		}
+		return p.Name()
+	}
+	var buf bytes.Buffer
+	writeHeader(&buf, page, "References to the declarations in "+xf.rel, "source", srcPage(xf.rel))
+	inspectIdents(xf.file, func(id *ast.Ident, _ []ast.Node) {
+		obj := info.Defs[id]
+		if obj == nil || id.Name == "_" {
+			return
+		}
+		pos := idx.fset.Position(id.Pos())
+		anchor := declAnchor(pos.Line, pos.Column)
+		fmt.Fprintf(&buf, "<h2 id=\"%s\"><a href=\"%s#%s\">%s</a></h2>\n", anchor, html.EscapeString(relLink(page, srcPage(xf.rel))), anchor, html.EscapeString(id.Name))
+		fmt.Fprintf(&buf, "<pre>%s</pre>\n", html.EscapeString(idx.declText(xf.file, id, obj, qual)))
+		decl, _ := idx.declPos(obj)
+		refs := idx.refs[decl]
+		if len(refs) == 0 {
+			buf.WriteString("<p>No references.</p>\n")
+			return
+		}
+		buf.WriteString("<ul>\n")
+		for _, r := range refs {
+			fmt.Fprintf(&buf, "<li><a href=\"%s#L%d\">%s:%d:%d</a> %s</li>\n", html.EscapeString(relLink(page, srcPage(r.file.rel))), r.line, html.EscapeString(r.file.rel), r.line, r.column, r.kind)
+		}
+		buf.WriteString("</ul>\n")
+	})
+	writeFooter(&buf)
+	return buf.Bytes()
+}
+
+// declText returns the declaration of obj, declared by id in f, as
+// printed by go/printer without any function body or comments. If
+// id is not declared by a function, type, variable, constant or
+// field declaration, the object is described by types.ObjectString.
+func (idx *xrefIndex) declText(f *ast.File, id *ast.Ident, obj types.Object, qual types.Qualifier) string {
+	path, _ := astutil.PathEnclosingInterval(f, id.Pos(), id.End())
+	var node ast.Node
+loop:
+	for i, n := range path {
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			if n.Name == id {
+				d := *n
+				d.Doc, d.Body = nil, nil
+				node = &d
+			}
+			break loop
+		case *ast.TypeSpec, *ast.ValueSpec:
+			gd, ok := path[i+1].(*ast.GenDecl)
+			if !ok {
+				break loop
+			}
+			switch n := n.(type) {
+			case *ast.TypeSpec:
+				d := *n
+				d.Doc, d.Comment = nil, nil
+				node = &ast.GenDecl{Tok: gd.Tok, Specs: []ast.Spec{&d}}
+			case *ast.ValueSpec:
+				d := *n
+				d.Doc, d.Comment = nil, nil
+				node = &ast.GenDecl{Tok: gd.Tok, Specs: []ast.Spec{&d}}
+			}
+			break loop
+		case *ast.Field:
+			d := *n
+			d.Doc, d.Comment = nil, nil
+			node = &d
+			break loop
+		case *ast.BlockStmt, *ast.FuncLit:
+			break loop
+		}
+	}
+	if node == nil {
+		return types.ObjectString(obj, qual)
+	}
+	var buf bytes.Buffer
+	cfg := &printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
+	if err := cfg.Fprint(&buf, idx.fset, node); err != nil {
+		return types.ObjectString(obj, qual)
+	}
+	return buf.String()
+}
+
+// writeSource writes src to buf as preformatted HTML, with numbered
+// lines and syntax highlighting. The identifiers starting at the
+// offsets in links are written as links.
+func writeSource(buf *bytes.Buffer, src []byte, links map[int]xrefLink) {
+	w := &htmlLines{buf: buf}
+	buf.WriteString("<pre>")
+	w.newLine()
+	fset := token.NewFileSet()
+	file := fset.AddFile("", -1, len(src))
+	var s scanner.Scanner
+	s.Init(file, src, nil, scanner.ScanComments)
+	last := 0
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok == token.SEMICOLON && lit != ";" {
+			// An automatically inserted semicolon.
+			continue
+		}
+		start := file.Offset(pos)
+		end := tokenEnd(src, start, tok, lit)
+		w.write(string(src[last:start]), "")
+		text := string(src[start:end])
+		last = end
+		switch {
+		case tok == token.IDENT:
+			link, ok := links[start]
+			if !ok {
+				w.write(text, "")
+				break
+			}
+			if link.anchor != "" {
+				fmt.Fprintf(buf, "<a class=\"id decl\" id=\"%s\"", link.anchor)
+			} else {
+				buf.WriteString("<a class=\"id\"")
+			}
+			if link.href != "" {
+				fmt.Fprintf(buf, " href=\"%s\"", html.EscapeString(link.href))
+			}
+			fmt.Fprintf(buf, " title=\"%s\">%s</a>", html.EscapeString(link.title), html.EscapeString(text))
+		case tok.IsKeyword():
+			w.write(text, "k")
+		case tok == token.COMMENT:
+			w.write(text, "c")
+		case tok == token.STRING || tok == token.CHAR:
+			w.write(text, "s")
+		case tok == token.INT || tok == token.FLOAT || tok == token.IMAG:
+			w.write(text, "n")
+		default:
+			w.write(text, "")
+		}
+	}
+	w.write(string(src[last:]), "")
+	buf.WriteString("</pre>\n")
+}
+
+// tokenEnd returns the offset in src of the end of the token
+// tok starting at offset start, with literal text lit. The
+// scanner removes carriage returns from comments and raw
+// strings, so their ends are found in src instead.
+func tokenEnd(src []byte, start int, tok token.Token, lit string) int {
+	switch {
+	case tok == token.COMMENT && strings.HasPrefix(lit, "//"):
+		if i := bytes.IndexByte(src[start:], '\n'); i >= 0 {
+			return start + i
+		}
+		return len(src)
+	case tok == token.COMMENT:
+		if i := bytes.Index(src[start+2:], []byte("*/")); i >= 0 {
+			return start + 2 + i + 2
+		}
+		return len(src)
+	case tok == token.STRING && strings.HasPrefix(lit, "`"):
+		if i := bytes.IndexByte(src[start+1:], '`'); i >= 0 {
+			return start + 1 + i + 1
+		}
+		return len(src)
+	case lit != "":
+		return start + len(lit)
+	}
+	return start + len(tok.String())
+}
+
+// htmlLines writes text as HTML, numbering each line
+// with an anchor that can be linked to.
+type htmlLines struct {
+	buf  *bytes.Buffer
+	line int
+}
+
+// newLine starts a new line.
+func (w *htmlLines) newLine() {
+	w.line++
+	fmt.Fprintf(w.buf, "<a class=\"ln\" id=\"L%d\" href=\"#L%d\">%d</a>", w.line, w.line, w.line)
+}
+
+// write writes text in a span with the given
+// class, or none if class is empty.
+func (w *htmlLines) write(text, class string) {
+	for i, line := range strings.Split(text, "\n") {
+		if i > 0 {
+			w.buf.WriteString("\n")
+			w.newLine()
+		}
+		if line == "" {
+			continue
+		}
+		if class != "" {
+			fmt.Fprintf(w.buf, "<span class=\"%s\">%s</span>", class, html.EscapeString(line))
+		} else {
+			w.buf.WriteString(html.EscapeString(line))
+		}
+	}
+}
+
+// writeSite writes all the pages of the site to files
+// in the directory dir, creating it if necessary.
+func (idx *xrefIndex) writeSite(dir string) error {
+	for _, page := range idx.pages() {
+		data, err := idx.page(page)
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(dir, filepath.FromSlash(page))
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(path, data, 0666); err != nil {
+			return err
+		}
+	}
+	return nil
+}
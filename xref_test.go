@@ -0,0 +1,147 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rogpeppe/godef/internal/testfiles"
+	"golang.org/x/tools/go/packages"
+)
+
+var xrefFiles = map[string]string{
+	"go.mod": "module example.com/m\n",
+	"a/a.go": `package a
+
+import "strings"
+
+// T is a type.
+type T struct {
+	Name string
+}
+
+// Upper returns the name in upper case.
+func (t *T) Upper() string {
+	return strings.ToUpper(t.Name)
+}
+`,
+	"a/a_test.go": `package a
+
+var u = (&T{}).Upper
+`,
+	"a/x_test.go": `package a_test
+
+import "example.com/m/a"
+
+var _ = a.T{Name: "x"}
+`,
+	"b/b.go": `package b
+
+import "example.com/m/a"
+
+func Set(t *a.T) {
+	t.Name = "<b>" // a comment
+	_ = t.Upper()
+}
+`,
+}
+
+var xrefTests = []struct {
+	path   string
+	status int
+	want   []string
+}{{
+	path:   "/",
+	status: http.StatusOK,
+	want: []string{
+		`<li><a href="pkg/a/index.html">example.com/m/a</a> (package a)</li>`,
+		`<li><a href="pkg/b/index.html">example.com/m/b</a> (package b)</li>`,
+	},
+}, {
+	path:   "/pkg/a/index.html",
+	status: http.StatusOK,
+	want: []string{
+		`<li><a href="../../src/a/a.go.html">a.go</a> (<a href="../../refs/a/a.go.html">references</a>)</li>`,
+		`<li><a href="../../src/a/a_test.go.html">a_test.go</a> (<a href="../../refs/a/a_test.go.html">references</a>)</li>`,
+		`<li><a href="../../src/a/x_test.go.html">x_test.go</a> (<a href="../../refs/a/x_test.go.html">references</a>)</li>`,
+		`<li><a href="../../src/a/a.go.html#L6C6">T</a></li>`,
+		`<li><a href="../../src/a/a_test.go.html#L3C5">u</a></li>`,
+	},
+}, {
+	path:   "/src/b/b.go.html",
+	status: http.StatusOK,
+	want: []string{
+		`<a class="ln" id="L5" href="#L5">5</a><span class="k">func</span> <a class="id decl" id="L5C6" href="../../refs/b/b.go.html#L5C6" title="func Set(t *a.T)">Set</a>`,
+		`<a class="id" href="../../src/a/a.go.html#L7C2" title="field Name string">Name</a>`,
+		`<span class="s">&#34;&lt;b&gt;&#34;</span> <span class="c">// a comment</span>`,
+	},
+}, {
+	path:   "/refs/a/a.go.html",
+	status: http.StatusOK,
+	want: []string{
+		"<pre>type T struct {\n\tName string\n}</pre>",
+		"<pre>func (t *T) Upper() string</pre>",
+		`<a href="../../src/b/b.go.html#L6">b/b.go:6:4</a> write`,
+		`<a href="../../src/b/b.go.html#L7">b/b.go:7:8</a> read`,
+		`<a href="../../src/a/a_test.go.html#L3">a/a_test.go:3:16</a> read`,
+		`<a href="../../src/a/x_test.go.html#L5">a/x_test.go:5:13</a>`,
+	},
+}, {
+	path:   "/src/a/a.go.html",
+	status: http.StatusOK,
+	want: []string{
+		`href="../../ext/`,
+		`/src/strings/strings.go.html#L`,
+	},
+}, {
+	path:   "/src/c/c.go.html",
+	status: http.StatusNotFound,
+}, {
+	path:   "/pkg/c/index.html",
+	status: http.StatusNotFound,
+}}
+
+func TestXref(t *testing.T) {
+	dir := testfiles.Write(t, xrefFiles)
+	defer os.RemoveAll(dir)
+	idx, err := buildXref(&packages.Config{}, filepath.Join(dir, "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range xrefTests {
+		rec := httptest.NewRecorder()
+		idx.ServeHTTP(rec, httptest.NewRequest("GET", test.path, nil))
+		if rec.Code != test.status {
+			t.Errorf("%s: got status %d; want %d", test.path, rec.Code, test.status)
+			continue
+		}
+		body := rec.Body.String()
+		for _, want := range test.want {
+			if !strings.Contains(body, want) {
+				t.Errorf("%s: page does not contain %q; got\n%s", test.path, want, body)
+			}
+		}
+	}
+	out := filepath.Join(dir, "html")
+	if err := idx.writeSite(out); err != nil {
+		t.Fatal(err)
+	}
+	for _, page := range idx.pages() {
+		want, err := idx.page(page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadFile(filepath.Join(out, filepath.FromSlash(page)))
+		if err != nil {
+			t.Errorf("page %s not written: %v", page, err)
+			continue
+		}
+		if string(got) != string(want) {
+			t.Errorf("page %s written wrongly", page)
+		}
+	}
+}